@@ -0,0 +1,89 @@
+// Command envdoc prints the environment variables accepted by the shared
+// config structs, for generating the configuration section of a README:
+//
+//	go run github.com/Zorynix/shared/cmd/envdoc -types database,redis -prefix APP
+//
+// Services documenting their own config structs call config.DescribeEnv and
+// config.WriteEnvMarkdown from a small generator of their own.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Zorynix/shared/pkg/config"
+)
+
+var configTypes = map[string]interface{}{
+	"base":       config.BaseConfig{},
+	"database":   config.DatabaseConfig{},
+	"redis":      config.RedisConfig{},
+	"grpc":       config.GRPCConfig{},
+	"security":   config.SecurityConfig{},
+	"monitoring": config.MonitoringConfig{},
+}
+
+func main() {
+	types := flag.String("types", "", "comma-separated config types to document (default: all)")
+	prefix := flag.String("prefix", "", "environment variable prefix")
+	format := flag.String("format", "markdown", "output format: markdown or table")
+	flag.Parse()
+
+	if err := run(*types, *prefix, *format); err != nil {
+		fmt.Fprintln(os.Stderr, "envdoc:", err)
+		os.Exit(1)
+	}
+}
+
+func run(types, prefix, format string) error {
+	names := make([]string, 0, len(configTypes))
+	if types == "" {
+		for name := range configTypes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	} else {
+		for _, name := range strings.Split(types, ",") {
+			names = append(names, strings.TrimSpace(name))
+		}
+	}
+
+	var vars []config.EnvVar
+	for _, name := range names {
+		configType, ok := configTypes[name]
+		if !ok {
+			return fmt.Errorf("unknown config type %q", name)
+		}
+
+		described, err := config.DescribeEnv(configType, buildPrefix(prefix, name))
+		if err != nil {
+			return fmt.Errorf("describe %s: %w", name, err)
+		}
+		vars = append(vars, described...)
+	}
+
+	switch format {
+	case "markdown":
+		return config.WriteEnvMarkdown(os.Stdout, vars)
+	case "table":
+		return config.WriteEnvTable(os.Stdout, vars)
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// buildPrefix nests each type under its name, matching how the structs are
+// usually embedded in a service config (`database:`, `redis:`, ...). The base
+// config is conventionally inlined.
+func buildPrefix(prefix, name string) string {
+	if name == "base" {
+		return prefix
+	}
+	if prefix == "" {
+		return strings.ToUpper(name)
+	}
+	return prefix + "_" + strings.ToUpper(name)
+}
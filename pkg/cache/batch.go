@@ -0,0 +1,199 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Value is an encoded cache entry returned by batch reads.
+type Value []byte
+
+// Decode deserializes the value into dest with the codec it was written
+// with.
+func (v Value) Decode(dest interface{}) error {
+	if err := decodeValue(v, dest); err != nil {
+		return fmt.Errorf("cache unmarshal error: %w", err)
+	}
+	return nil
+}
+
+// Item is a single write in SetMany.
+type Item struct {
+	Key   string
+	Value interface{}
+	TTL   time.Duration
+}
+
+// GetMany fetches keys in one round trip. Found values are returned by key;
+// keys that are not cached are returned in missing, in request order. Keys
+// holding a tombstone are in neither, since they are known not to exist.
+// Every key counts as a hit or a miss in the metrics.
+func (c *RedisCache) GetMany(ctx context.Context, keys []string) (map[string]Value, []string, error) {
+	return c.getMany(ctx, keys, nil)
+}
+
+// getMany is GetMany that, when ttls is not nil, also fills it with the
+// remaining TTL of each key, in the order of keys, as PTTL reports it.
+func (c *RedisCache) getMany(ctx context.Context, keys []string, ttls []time.Duration) (map[string]Value, []string, error) {
+	if len(keys) == 0 {
+		return map[string]Value{}, nil, nil
+	}
+
+	start := time.Now()
+
+	fullKeys := make([]string, len(keys))
+	for i, key := range keys {
+		fullKeys[i] = c.buildKey(key)
+	}
+
+	results, err := c.mget(ctx, fullKeys, ttls)
+	if err != nil {
+		c.recordBatch(opGetMany, keys, start, func(int) opResult { return resultError })
+		return nil, nil, fmt.Errorf("cache get many error: %w", err)
+	}
+
+	values := make(map[string]Value, len(keys))
+	var missing []string
+	c.recordBatch(opGetMany, keys, start, func(i int) opResult {
+		if results[i] == nil {
+			missing = append(missing, keys[i])
+			return resultMiss
+		}
+		if !isTombstone(results[i]) {
+			values[keys[i]] = results[i]
+		}
+		return resultHit
+	})
+
+	return values, missing, nil
+}
+
+// mget returns one entry per key, nil for missing keys, and stores their
+// PTTLs in ttls unless it is nil. Cluster clients, and reads with TTLs, get
+// a pipeline of GETs because MGET cannot span hash slots or return TTLs.
+func (c *RedisCache) mget(ctx context.Context, fullKeys []string, ttls []time.Duration) ([][]byte, error) {
+	results := make([][]byte, len(fullKeys))
+
+	if _, ok := c.client.(*redis.ClusterClient); ok || ttls != nil {
+		cmds := make([]*redis.StringCmd, len(fullKeys))
+		pttls := make([]*redis.DurationCmd, len(fullKeys))
+		_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, key := range fullKeys {
+				cmds[i] = pipe.Get(ctx, key)
+				if ttls != nil {
+					pttls[i] = pipe.PTTL(ctx, key)
+				}
+			}
+			return nil
+		})
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for i, cmd := range cmds {
+			if data, err := cmd.Bytes(); err == nil {
+				results[i] = data
+			}
+			if ttls != nil {
+				ttls[i] = pttls[i].Val()
+			}
+		}
+		return results, nil
+	}
+
+	raw, err := c.client.MGet(ctx, fullKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range raw {
+		if s, ok := value.(string); ok {
+			results[i] = []byte(s)
+		}
+	}
+	return results, nil
+}
+
+// SetMany writes all items in one pipeline, each with its own TTL. Items
+// that fail to encode are not written and fail the call.
+func (c *RedisCache) SetMany(ctx context.Context, items []Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+
+	keys := make([]string, len(items))
+	encoded := make([][]byte, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+		data, err := c.encode(item.Value)
+		if err != nil {
+			c.recordError(opSetMany, item.Key)
+			return fmt.Errorf("cache marshal error for key %s: %w", item.Key, err)
+		}
+		encoded[i] = data
+	}
+
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, item := range items {
+			pipe.Set(ctx, c.buildKey(item.Key), encoded[i], item.TTL)
+		}
+		return nil
+	})
+	if err != nil {
+		c.recordBatch(opSetMany, keys, start, func(int) opResult { return resultError })
+		return fmt.Errorf("cache set many error: %w", err)
+	}
+
+	c.recordBatch(opSetMany, keys, start, func(int) opResult { return resultOK })
+
+	written := make([]string, len(items))
+	for i, item := range items {
+		written[i] = c.buildKey(item.Key)
+	}
+	c.publishKeyEvent(ctx, KeyEventSet, written...)
+
+	return nil
+}
+
+// DeleteMany removes keys and returns how many existed.
+func (c *RedisCache) DeleteMany(ctx context.Context, keys []string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	start := time.Now()
+
+	fullKeys := make([]string, len(keys))
+	for i, key := range keys {
+		fullKeys[i] = c.buildKey(key)
+	}
+
+	_, cluster := c.client.(*redis.ClusterClient)
+	deleted, removed, err := c.unlinkKeys(ctx, c.client, fullKeys, cluster)
+	c.publishKeyEvent(ctx, KeyEventDelete, removed...)
+	if err != nil {
+		c.recordBatch(opDeleteMany, keys, start, func(int) opResult { return resultError })
+		return deleted, fmt.Errorf("cache delete many error: %w", err)
+	}
+
+	c.recordBatch(opDeleteMany, keys, start, func(int) opResult { return resultOK })
+
+	return deleted, nil
+}
+
+// recordBatch records every key of a batch as its own operation, splitting
+// the batch duration evenly between them.
+func (c *RedisCache) recordBatch(op string, keys []string, start time.Time, result func(i int) opResult) {
+	duration := time.Since(start)
+	perKey := duration / time.Duration(len(keys))
+
+	c.metrics.duration.WithLabelValues(c.service, op).Observe(duration.Seconds())
+	for i, key := range keys {
+		r := result(i)
+		c.metrics.operations.WithLabelValues(c.service, op, r.String()).Inc()
+		c.stats.record(op, key, r, perKey)
+	}
+}
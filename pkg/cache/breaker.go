@@ -0,0 +1,516 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/proto"
+
+	apperrors "github.com/Zorynix/shared/pkg/errors"
+)
+
+var ErrBreakerOpen = apperrors.NewAppError(apperrors.ErrCircuitBreakerOpen, "Cache circuit breaker is open")
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens the
+	// breaker. Defaults to 5.
+	FailureThreshold int `yaml:"failure_threshold" validate:"min=0"`
+	// OpenTimeout is how long the breaker stays open before letting trial
+	// calls through. Defaults to 30s.
+	OpenTimeout time.Duration `yaml:"open_timeout"`
+	// HalfOpenMaxCalls is the number of trial calls allowed at once while
+	// half-open. Defaults to 1.
+	HalfOpenMaxCalls int `yaml:"half_open_max_calls" validate:"min=0"`
+	// SuccessThreshold is the number of successful trial calls that closes
+	// the breaker. Defaults to 1.
+	SuccessThreshold int `yaml:"success_threshold" validate:"min=0"`
+	// ReadsAsMisses makes reads report a miss instead of ErrBreakerOpen
+	// while the breaker is open, so callers fall back to the source without
+	// special-casing the breaker. GetOrLoad always calls the loader directly
+	// while open.
+	ReadsAsMisses bool `yaml:"reads_as_misses"`
+}
+
+const (
+	defaultBreakerFailureThreshold = 5
+	defaultBreakerOpenTimeout      = 30 * time.Second
+)
+
+// BreakerCache wraps a Cache with a circuit breaker, so that while Redis is
+// down calls fail fast with ErrBreakerOpen instead of each waiting for a
+// timeout. Only connection, timeout and Redis server errors count as
+// failures; misses, not-found results and encoding errors count as successes.
+//
+// Use NewTaggedBreakerCache to keep SetWithTags on a TaggedCache.
+type BreakerCache struct {
+	cache   Cache
+	codec   Codec
+	config  BreakerConfig
+	clock   Clock
+	service string
+	gauge   prometheus.Gauge
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	successes int
+	trials    int
+	openedAt  time.Time
+	// generation changes on every state change, so outcomes of calls
+	// admitted under an earlier state are ignored.
+	generation uint64
+}
+
+type BreakerOption func(*breakerOptions)
+
+type breakerOptions struct {
+	registerer prometheus.Registerer
+	namespace  string
+	metrics    *Metrics
+	clock      Clock
+}
+
+// WithBreakerRegisterer registers the breaker's Prometheus metrics with reg
+// instead of the default registerer.
+func WithBreakerRegisterer(reg prometheus.Registerer) BreakerOption {
+	return func(o *breakerOptions) {
+		o.registerer = reg
+	}
+}
+
+// WithBreakerNamespace prefixes the breaker's Prometheus metric names.
+func WithBreakerNamespace(namespace string) BreakerOption {
+	return func(o *breakerOptions) {
+		o.namespace = namespace
+	}
+}
+
+// WithBreakerMetrics uses m as is, leaving its registration to the caller.
+func WithBreakerMetrics(m *Metrics) BreakerOption {
+	return func(o *breakerOptions) {
+		o.metrics = m
+	}
+}
+
+// WithBreakerClock sets the clock the breaker uses for its open timeout.
+func WithBreakerClock(clock Clock) BreakerOption {
+	return func(o *breakerOptions) {
+		o.clock = clock
+	}
+}
+
+func NewBreakerCache(cache Cache, config BreakerConfig, serviceName string, opts ...BreakerOption) (*BreakerCache, error) {
+	o := breakerOptions{registerer: prometheus.DefaultRegisterer}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	metrics := o.metrics
+	if metrics == nil {
+		var err error
+		metrics, err = metricsFor(o.registerer, o.namespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to register cache metrics: %w", err)
+		}
+	}
+
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = defaultBreakerFailureThreshold
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = defaultBreakerOpenTimeout
+	}
+	if config.HalfOpenMaxCalls <= 0 {
+		config.HalfOpenMaxCalls = 1
+	}
+	if config.SuccessThreshold <= 0 {
+		config.SuccessThreshold = 1
+	}
+
+	clock := o.clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+
+	b := &BreakerCache{
+		cache:   cache,
+		codec:   codecOf(cache),
+		config:  config,
+		clock:   clock,
+		service: serviceName,
+		gauge:   metrics.breakerState.WithLabelValues(serviceName),
+	}
+	b.gauge.Set(float64(BreakerClosed))
+	return b, nil
+}
+
+// TaggedBreakerCache is a BreakerCache around a TaggedCache. SetWithTags
+// goes through the breaker like Set.
+type TaggedBreakerCache struct {
+	*BreakerCache
+	next TaggedCache
+}
+
+func NewTaggedBreakerCache(cache TaggedCache, config BreakerConfig, serviceName string, opts ...BreakerOption) (*TaggedBreakerCache, error) {
+	b, err := NewBreakerCache(cache, config, serviceName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &TaggedBreakerCache{BreakerCache: b, next: cache}, nil
+}
+
+func (b *TaggedBreakerCache) SetWithTags(ctx context.Context, key string, value interface{}, ttl time.Duration, tags []string) error {
+	return b.do(func() error {
+		return b.next.SetWithTags(ctx, key, value, ttl, tags)
+	})
+}
+
+func (b *BreakerCache) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.currentState()
+}
+
+// Unwrap returns the wrapped cache.
+func (b *BreakerCache) Unwrap() Cache {
+	return b.cache
+}
+
+func (b *BreakerCache) Get(ctx context.Context, key string, dest interface{}) error {
+	generation, ok := b.allow()
+	if !ok {
+		if b.config.ReadsAsMisses {
+			return ErrCacheKeyNotFound
+		}
+		return ErrBreakerOpen
+	}
+	err := b.cache.Get(ctx, key, dest)
+	b.done(generation, err)
+	return err
+}
+
+func (b *BreakerCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return b.do(func() error {
+		return b.cache.Set(ctx, key, value, ttl)
+	})
+}
+
+func (b *BreakerCache) Delete(ctx context.Context, key string) error {
+	return b.do(func() error {
+		return b.cache.Delete(ctx, key)
+	})
+}
+
+func (b *BreakerCache) DeletePattern(ctx context.Context, pattern string) (int64, error) {
+	var deleted int64
+	err := b.do(func() error {
+		var err error
+		deleted, err = b.cache.DeletePattern(ctx, pattern)
+		return err
+	})
+	return deleted, err
+}
+
+func (b *BreakerCache) Exists(ctx context.Context, key string) (bool, error) {
+	generation, ok := b.allow()
+	if !ok {
+		if b.config.ReadsAsMisses {
+			return false, nil
+		}
+		return false, ErrBreakerOpen
+	}
+	exists, err := b.cache.Exists(ctx, key)
+	b.done(generation, err)
+	return exists, err
+}
+
+func (b *BreakerCache) GetMetrics() CacheMetrics {
+	return b.cache.GetMetrics()
+}
+
+func (b *BreakerCache) Warm(ctx context.Context, keys []WarmupKey) error {
+	return b.do(func() error {
+		return b.cache.Warm(ctx, keys)
+	})
+}
+
+func (b *BreakerCache) InvalidateByTags(ctx context.Context, tags []string) error {
+	return b.do(func() error {
+		return b.cache.InvalidateByTags(ctx, tags)
+	})
+}
+
+// GetOrLoad passes through while the breaker lets calls through, and calls
+// loader directly while it is open. The wrapped cache hides its own Redis
+// failures behind the loader, so it reports them to the breaker through ctx
+// instead; loader errors never move the breaker.
+//
+// While open, the loader's result is stored in dest directly when their
+// types allow, and otherwise goes through the wrapped cache's codec.
+func (b *BreakerCache) GetOrLoad(ctx context.Context, key string, dest interface{}, ttl time.Duration, loader LoaderFunc) error {
+	if generation, ok := b.allow(); ok {
+		probe := &breakerProbe{}
+		err := b.cache.GetOrLoad(context.WithValue(ctx, breakerProbeKey{}, probe), key, dest, ttl, loader)
+		b.done(generation, probe.failure())
+		return err
+	}
+
+	value, err := loader(ctx)
+	if err != nil {
+		return err
+	}
+	if assignValue(value, dest) {
+		return nil
+	}
+	data, err := encodeValue(b.codec, value)
+	if err != nil {
+		return fmt.Errorf("cache marshal error: %w", err)
+	}
+	if err := decodeValue(data, dest); err != nil {
+		return fmt.Errorf("cache unmarshal error: %w", err)
+	}
+	return nil
+}
+
+func (b *BreakerCache) GetMany(ctx context.Context, keys []string) (map[string]Value, []string, error) {
+	generation, ok := b.allow()
+	if !ok {
+		if b.config.ReadsAsMisses {
+			return map[string]Value{}, append([]string(nil), keys...), nil
+		}
+		return nil, nil, ErrBreakerOpen
+	}
+	values, missing, err := b.cache.GetMany(ctx, keys)
+	b.done(generation, err)
+	return values, missing, err
+}
+
+func (b *BreakerCache) SetMany(ctx context.Context, items []Item) error {
+	return b.do(func() error {
+		return b.cache.SetMany(ctx, items)
+	})
+}
+
+func (b *BreakerCache) DeleteMany(ctx context.Context, keys []string) (int64, error) {
+	var deleted int64
+	err := b.do(func() error {
+		var err error
+		deleted, err = b.cache.DeleteMany(ctx, keys)
+		return err
+	})
+	return deleted, err
+}
+
+func (b *BreakerCache) do(fn func() error) error {
+	generation, ok := b.allow()
+	if !ok {
+		return ErrBreakerOpen
+	}
+	err := fn()
+	b.done(generation, err)
+	return err
+}
+
+// allow reports whether a call may go through, moving an open breaker to
+// half-open once its timeout has passed, and returns the generation the call
+// was admitted under. Every allowed call must be followed by done.
+func (b *BreakerCache) allow() (uint64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState() {
+	case BreakerOpen:
+		return 0, false
+	case BreakerHalfOpen:
+		if b.trials >= b.config.HalfOpenMaxCalls {
+			return 0, false
+		}
+		b.trials++
+	}
+	return b.generation, true
+}
+
+// done records the outcome of a call admitted under generation. Calls
+// admitted before the last state change are ignored, so e.g. a slow call
+// from before the breaker opened cannot use up a half-open trial.
+func (b *BreakerCache) done(generation uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	halfOpen := b.state == BreakerHalfOpen
+	if halfOpen {
+		b.trials--
+	}
+
+	if isBreakerFailure(err) {
+		b.failures++
+		if halfOpen || b.failures >= b.config.FailureThreshold {
+			b.setState(BreakerOpen)
+		}
+		return
+	}
+
+	b.failures = 0
+	if halfOpen {
+		b.successes++
+		if b.successes >= b.config.SuccessThreshold {
+			b.setState(BreakerClosed)
+		}
+	}
+}
+
+// currentState must be called with mu held.
+func (b *BreakerCache) currentState() BreakerState {
+	if b.state == BreakerOpen && b.clock.Now().Sub(b.openedAt) >= b.config.OpenTimeout {
+		b.setState(BreakerHalfOpen)
+	}
+	return b.state
+}
+
+// setState must be called with mu held.
+func (b *BreakerCache) setState(state BreakerState) {
+	b.state = state
+	b.failures = 0
+	b.successes = 0
+	b.trials = 0
+	b.generation++
+	if state == BreakerOpen {
+		b.openedAt = b.clock.Now()
+	}
+	b.gauge.Set(float64(state))
+}
+
+// isBreakerFailure reports whether err means Redis is unreachable or
+// failing: a network error, a timeout or a Redis server error. A warmup
+// counts only if no key succeeded.
+func isBreakerFailure(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) {
+		return false
+	}
+
+	var warmErr *WarmError
+	if errors.As(err, &warmErr) {
+		if warmErr.Report.Succeeded > 0 {
+			return false
+		}
+		for _, failure := range warmErr.Report.Failed {
+			if isBreakerFailure(failure.Err) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, redis.ErrClosed) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var redisErr redis.Error
+	return errors.As(err, &redisErr)
+}
+
+// codecOf returns the codec cache encodes values with, looking through
+// wrappers with an Unwrap method. Caches without one store JSON.
+func codecOf(cache Cache) Codec {
+	for {
+		switch c := cache.(type) {
+		case *RedisCache:
+			return c.codec
+		case interface{ Unwrap() Cache }:
+			cache = c.Unwrap()
+		default:
+			return JSONCodec
+		}
+	}
+}
+
+// assignValue stores value in dest without encoding it, when dest points to
+// a value of the same type or both are the same proto message type. It
+// reports whether it did.
+func assignValue(value, dest interface{}) bool {
+	target := reflect.ValueOf(dest)
+	if value == nil || target.Kind() != reflect.Pointer || target.IsNil() {
+		return false
+	}
+
+	if msg, ok := value.(proto.Message); ok {
+		if destMsg, ok := dest.(proto.Message); ok && destMsg.ProtoReflect().Descriptor() == msg.ProtoReflect().Descriptor() {
+			proto.Reset(destMsg)
+			proto.Merge(destMsg, msg)
+			return true
+		}
+	}
+
+	source := reflect.ValueOf(value)
+	if source.Type() != target.Elem().Type() {
+		return false
+	}
+	target.Elem().Set(source)
+	return true
+}
+
+type breakerProbeKey struct{}
+
+// breakerProbe collects the Redis failures GetOrLoad recovers from, so a
+// BreakerCache can count them although the call itself succeeds.
+type breakerProbe struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (p *breakerProbe) failure() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// reportRecovered passes a Redis error that was recovered from to the
+// BreakerCache whose GetOrLoad is running in ctx, if any.
+func reportRecovered(ctx context.Context, err error) {
+	probe, ok := ctx.Value(breakerProbeKey{}).(*breakerProbe)
+	if !ok || !isBreakerFailure(err) {
+		return
+	}
+	probe.mu.Lock()
+	defer probe.mu.Unlock()
+	if probe.err == nil {
+		probe.err = err
+	}
+}
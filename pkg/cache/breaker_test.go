@@ -0,0 +1,402 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// serverError is a Redis error reply, like the ones go-redis returns.
+type serverError string
+
+func (e serverError) Error() string { return string(e) }
+
+func (serverError) RedisError() {}
+
+// stubCache fails Get and the cache side of GetOrLoad with err.
+type stubCache struct {
+	Cache
+	err   error
+	loads int
+}
+
+func (s *stubCache) Get(context.Context, string, interface{}) error {
+	return s.err
+}
+
+func (s *stubCache) GetOrLoad(ctx context.Context, _ string, dest interface{}, _ time.Duration, loader LoaderFunc) error {
+	s.loads++
+	if s.err != nil {
+		reportRecovered(ctx, s.err)
+	}
+	value, err := loader(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := encodeValue(JSONCodec, value)
+	if err != nil {
+		return err
+	}
+	return decodeValue(data, dest)
+}
+
+func newTestBreaker(t *testing.T, cache Cache, config BreakerConfig, clock Clock) *BreakerCache {
+	t.Helper()
+	b, err := NewBreakerCache(cache, config, "test", WithBreakerMetrics(NewMetrics("")), WithBreakerClock(clock))
+	if err != nil {
+		t.Fatalf("NewBreakerCache: %v", err)
+	}
+	return b
+}
+
+func TestIsBreakerFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"redis nil", redis.Nil, false},
+		{"miss", ErrCacheKeyNotFound, false},
+		{"tombstone", fmt.Errorf("user:1: %w", ErrKnownNotFound), false},
+		{"canceled", context.Canceled, false},
+		{"marshal", fmt.Errorf("cache marshal error: %w", &json.UnsupportedTypeError{}), false},
+		{"caller", errors.New("invalid argument"), false},
+		{"deadline", fmt.Errorf("cache get error: %w", context.DeadlineExceeded), true},
+		{"eof", fmt.Errorf("cache get error: %w", io.EOF), true},
+		{"closed", redis.ErrClosed, true},
+		{"net", fmt.Errorf("cache get error: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}), true},
+		{"server", fmt.Errorf("cache set error: %w", serverError("OOM command not allowed")), true},
+		{"partial warmup", &WarmError{Report: &WarmReport{Total: 2, Succeeded: 1, Failed: []WarmFailure{{Key: "a", Err: io.EOF}}}}, false},
+		{"warmup encode", &WarmError{Report: &WarmReport{Total: 1, Failed: []WarmFailure{{Key: "a", Err: errors.New("encode")}}}}, false},
+		{"warmup down", &WarmError{Report: &WarmReport{Total: 1, Failed: []WarmFailure{{Key: "a", Err: io.EOF}}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBreakerFailure(tt.err); got != tt.want {
+				t.Errorf("isBreakerFailure(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	config := BreakerConfig{FailureThreshold: 2, OpenTimeout: 10 * time.Second, HalfOpenMaxCalls: 1, SuccessThreshold: 2}
+
+	type step struct {
+		advance time.Duration
+		err     error
+		// rejected means the call fails fast with ErrBreakerOpen.
+		rejected bool
+		want     BreakerState
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "opens after consecutive failures",
+			steps: []step{
+				{err: io.EOF, want: BreakerClosed},
+				{err: io.EOF, want: BreakerOpen},
+				{rejected: true, want: BreakerOpen},
+			},
+		},
+		{
+			name: "success resets the failure count",
+			steps: []step{
+				{err: io.EOF, want: BreakerClosed},
+				{want: BreakerClosed},
+				{err: io.EOF, want: BreakerClosed},
+			},
+		},
+		{
+			name: "misses are successes",
+			steps: []step{
+				{err: io.EOF, want: BreakerClosed},
+				{err: ErrCacheKeyNotFound, want: BreakerClosed},
+				{err: io.EOF, want: BreakerClosed},
+			},
+		},
+		{
+			name: "half-open after timeout and closes after successes",
+			steps: []step{
+				{err: io.EOF, want: BreakerClosed},
+				{err: io.EOF, want: BreakerOpen},
+				{advance: 9 * time.Second, rejected: true, want: BreakerOpen},
+				{advance: time.Second, want: BreakerHalfOpen},
+				{want: BreakerClosed},
+			},
+		},
+		{
+			name: "trial failure reopens",
+			steps: []step{
+				{err: io.EOF, want: BreakerClosed},
+				{err: io.EOF, want: BreakerOpen},
+				{advance: 10 * time.Second, err: io.EOF, want: BreakerOpen},
+				{rejected: true, want: BreakerOpen},
+				{advance: 10 * time.Second, want: BreakerHalfOpen},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := NewManualClock(time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC))
+			stub := &stubCache{}
+			b := newTestBreaker(t, stub, config, clock)
+
+			for i, s := range tt.steps {
+				clock.Advance(s.advance)
+				stub.err = s.err
+
+				err := b.Get(context.Background(), "key", nil)
+				if rejected := errors.Is(err, ErrBreakerOpen); rejected != s.rejected {
+					t.Fatalf("step %d: rejected = %v, want %v", i, rejected, s.rejected)
+				}
+				if got := b.State(); got != s.want {
+					t.Fatalf("step %d: state = %v, want %v", i, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerHalfOpenTrials(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxCalls  int
+		successes int
+	}{
+		{"single trial", 1, 1},
+		{"several trials", 3, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := NewManualClock(time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC))
+			config := BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Second, HalfOpenMaxCalls: tt.maxCalls, SuccessThreshold: tt.successes}
+			b := newTestBreaker(t, &stubCache{}, config, clock)
+
+			// A call admitted while closed finishes after the breaker opened
+			// and went half-open; it must not free a trial slot.
+			stale, ok := b.allow()
+			if !ok {
+				t.Fatal("closed breaker rejected a call")
+			}
+			generation, _ := b.allow()
+			b.done(generation, io.EOF)
+			clock.Advance(time.Second)
+
+			admitted := make([]uint64, 0, tt.maxCalls)
+			for range tt.maxCalls {
+				generation, ok := b.allow()
+				if !ok {
+					t.Fatalf("trial %d rejected", len(admitted))
+				}
+				admitted = append(admitted, generation)
+			}
+			if _, ok := b.allow(); ok {
+				t.Fatal("trial admitted beyond HalfOpenMaxCalls")
+			}
+
+			b.done(stale, nil)
+			if _, ok := b.allow(); ok {
+				t.Fatal("stale call freed a trial slot")
+			}
+			if got := b.State(); got != BreakerHalfOpen {
+				t.Fatalf("state after stale call = %v, want half-open", got)
+			}
+
+			for i := range tt.successes {
+				b.done(admitted[i], nil)
+			}
+			if got := b.State(); got != BreakerClosed {
+				t.Fatalf("state = %v, want closed", got)
+			}
+			for _, generation := range admitted[tt.successes:] {
+				b.done(generation, io.EOF)
+			}
+			if got := b.State(); got != BreakerClosed {
+				t.Fatalf("late trial moved closed breaker to %v", got)
+			}
+		})
+	}
+}
+
+func TestBreakerGetOrLoad(t *testing.T) {
+	clock := NewManualClock(time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC))
+	stub := &stubCache{err: io.EOF}
+	b := newTestBreaker(t, stub, BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Second}, clock)
+
+	loads := 0
+	loader := func(context.Context) (interface{}, error) {
+		loads++
+		return loads, nil
+	}
+
+	for range 2 {
+		var got int
+		if err := b.GetOrLoad(context.Background(), "key", &got, time.Minute, loader); err != nil {
+			t.Fatalf("GetOrLoad: %v", err)
+		}
+	}
+	if got := b.State(); got != BreakerOpen {
+		t.Fatalf("state = %v, want open after recovered Redis failures", got)
+	}
+
+	var got int
+	if err := b.GetOrLoad(context.Background(), "key", &got, time.Minute, loader); err != nil {
+		t.Fatalf("GetOrLoad while open: %v", err)
+	}
+	if stub.loads != 2 {
+		t.Errorf("cache called %d times, want 2: open breaker must skip it", stub.loads)
+	}
+	if got != 3 {
+		t.Errorf("got %d, want 3 from the loader", got)
+	}
+
+	// Loader errors say nothing about Redis.
+	clock.Advance(time.Second)
+	stub.err = nil
+	failing := func(context.Context) (interface{}, error) {
+		return nil, &net.OpError{Op: "dial", Err: errors.New("database down")}
+	}
+	_ = b.GetOrLoad(context.Background(), "key", &got, time.Minute, failing)
+	if got := b.State(); got != BreakerClosed {
+		t.Errorf("state = %v, want closed after a trial with only a loader error", got)
+	}
+}
+
+func TestTaggedBreakerCache(t *testing.T) {
+	ctx := context.Background()
+	redisCache, server := newTestRedisCache(t, "app")
+	clock := NewManualClock(time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC))
+	b, err := NewTaggedBreakerCache(redisCache, BreakerConfig{FailureThreshold: 1}, "test", WithBreakerMetrics(NewMetrics("")), WithBreakerClock(clock))
+	if err != nil {
+		t.Fatalf("NewTaggedBreakerCache: %v", err)
+	}
+
+	var cache Cache = Chain(b, HookMiddleware())
+	tagged, ok := cache.(TaggedCache)
+	if !ok {
+		t.Fatalf("%T does not implement TaggedCache", cache)
+	}
+	if err := tagged.SetWithTags(ctx, "key", 1, time.Minute, []string{"t"}); err != nil {
+		t.Fatalf("SetWithTags: %v", err)
+	}
+	if err := tagged.InvalidateByTags(ctx, []string{"t"}); err != nil {
+		t.Fatalf("InvalidateByTags: %v", err)
+	}
+	if exists, _ := tagged.Exists(ctx, "key"); exists {
+		t.Fatal("key survived its tag's invalidation")
+	}
+
+	server.SetError("READONLY You can't write against a read only replica")
+	if err := tagged.SetWithTags(ctx, "key", 1, time.Minute, []string{"t"}); err == nil {
+		t.Fatal("SetWithTags succeeded against a failing server")
+	}
+	if got := b.State(); got != BreakerOpen {
+		t.Fatalf("state = %v, want open after a failed SetWithTags", got)
+	}
+	if err := tagged.SetWithTags(ctx, "key", 1, time.Minute, nil); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("SetWithTags while open = %v, want ErrBreakerOpen", err)
+	}
+}
+
+func TestBreakerOpenGetOrLoadDecodes(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec Codec
+		value interface{}
+		dest  func() interface{}
+		want  func(dest interface{}) bool
+	}{
+		{
+			name:  "same type",
+			codec: JSONCodec,
+			value: codecValue{Name: "a", Count: 1},
+			dest:  func() interface{} { return &codecValue{} },
+			want: func(dest interface{}) bool {
+				return reflect.DeepEqual(*dest.(*codecValue), codecValue{Name: "a", Count: 1})
+			},
+		},
+		{
+			name:  "converted by the codec",
+			codec: JSONCodec,
+			value: 3,
+			dest:  func() interface{} { return new(int64) },
+			want:  func(dest interface{}) bool { return *dest.(*int64) == 3 },
+		},
+		{
+			name:  "proto message with a oneof",
+			codec: ProtoCodec,
+			value: structpb.NewStringValue("x"),
+			dest:  func() interface{} { return &structpb.Value{} },
+			want: func(dest interface{}) bool {
+				return proto.Equal(dest.(*structpb.Value), structpb.NewStringValue("x"))
+			},
+		},
+		{
+			name:  "proto message pointer",
+			codec: ProtoCodec,
+			value: structpb.NewNumberValue(2),
+			dest:  func() interface{} { return new(*structpb.Value) },
+			want: func(dest interface{}) bool {
+				return proto.Equal(*dest.(**structpb.Value), structpb.NewNumberValue(2))
+			},
+		},
+		{
+			name:  "other proto type through the codec",
+			codec: ProtoCodec,
+			value: wrapperspb.String("x"),
+			dest:  func() interface{} { return &wrapperspb.BytesValue{} },
+			want: func(dest interface{}) bool {
+				return string(dest.(*wrapperspb.BytesValue).GetValue()) == "x"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			server := miniredis.RunT(t)
+			redisCache := connectTestCache(t, server, Config{}, WithCodec(tt.codec))
+			clock := NewManualClock(time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC))
+			b := newTestBreaker(t, Chain(redisCache, HookMiddleware()), BreakerConfig{FailureThreshold: 1}, clock)
+			if b.codec != tt.codec {
+				t.Fatalf("breaker codec = %s, want %s", b.codec.Name(), tt.codec.Name())
+			}
+
+			server.SetError("LOADING Redis is loading the dataset in memory")
+			_ = b.Get(ctx, "key", nil)
+			if got := b.State(); got != BreakerOpen {
+				t.Fatalf("state = %v, want open", got)
+			}
+
+			dest := tt.dest()
+			err := b.GetOrLoad(ctx, "key", dest, time.Minute, func(context.Context) (interface{}, error) {
+				return tt.value, nil
+			})
+			if err != nil {
+				t.Fatalf("GetOrLoad: %v", err)
+			}
+			if !tt.want(dest) {
+				t.Errorf("dest = %v, want the loaded %v", dest, tt.value)
+			}
+		})
+	}
+}
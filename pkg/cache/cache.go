@@ -2,25 +2,38 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"sync"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	apperrors "github.com/Zorynix/shared/pkg/errors"
 )
 
 type Cache interface {
 	Get(ctx context.Context, key string, dest interface{}) error
 	Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error
 	Delete(ctx context.Context, key string) error
-	DeletePattern(ctx context.Context, pattern string) error
+	DeletePattern(ctx context.Context, pattern string) (int64, error)
 	Exists(ctx context.Context, key string) (bool, error)
 	GetMetrics() CacheMetrics
 	Warm(ctx context.Context, keys []WarmupKey) error
 	InvalidateByTags(ctx context.Context, tags []string) error
+	GetOrLoad(ctx context.Context, key string, dest interface{}, ttl time.Duration, loader LoaderFunc) error
+	GetMany(ctx context.Context, keys []string) (map[string]Value, []string, error)
+	SetMany(ctx context.Context, items []Item) error
+	DeleteMany(ctx context.Context, keys []string) (int64, error)
+}
+
+// TaggedCache is a Cache that can tag keys for InvalidateByTags. The
+// middlewares in this package implement it when the cache they wrap does.
+type TaggedCache interface {
+	Cache
+	SetWithTags(ctx context.Context, key string, value interface{}, ttl time.Duration, tags []string) error
 }
 
 type WarmupKey struct {
@@ -37,20 +50,87 @@ type CacheMetrics struct {
 	TotalOps    int64
 	HitRate     float64
 	AverageTime time.Duration
+
+	// StaleHits counts hits served past their soft TTL by SWRCache. They
+	// are included in Hits.
+	StaleHits int64
+
+	// Since is when counting started: cache creation for GetMetrics, the
+	// last reset for WindowMetrics.
+	Since time.Time
+	// Operations and Namespaces break the totals down by operation name
+	// ("get", "set", ...) and by the first key segment after the prefix.
+	// They are nil in the breakdown entries themselves.
+	Operations map[string]CacheMetrics
+	Namespaces map[string]CacheMetrics
+
+	// CompressionRatio is the uncompressed to compressed size of values
+	// that went through compression, or zero if none did.
+	CompressionRatio float64
 }
 
 type RedisCache struct {
-	client    *redis.Client
+	client    redis.UniversalClient
 	keyPrefix string
-	metrics   *cacheMetrics
-	tagIndex  sync.Map
+	service   string
+	metrics   *Metrics
+	stats     *metricsRecorder
+	codec     Codec
+
+	loads         flightGroup
+	loadLockTTL   time.Duration
+	loadTimeout   time.Duration
+	scanBatchSize int64
+
+	compressionID        byte
+	compressionThreshold int
+
+	negativeTTL time.Duration
+	notFound    map[string]*apperrors.AppError
+
+	db        int
+	keyEvents bool
+
+	keys *CacheKeyBuilder
+}
+
+type Option func(*options)
+
+type options struct {
+	registerer prometheus.Registerer
+	namespace  string
+	metrics    *Metrics
+	codec      Codec
+	notFound   map[string]*apperrors.AppError
+}
+
+// WithRegisterer registers the cache's Prometheus metrics with reg instead
+// of the default registerer.
+func WithRegisterer(reg prometheus.Registerer) Option {
+	return func(o *options) {
+		o.registerer = reg
+	}
+}
+
+// WithNamespace prefixes the cache's Prometheus metric names.
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
 }
 
-type cacheMetrics struct {
-	hits     prometheus.Counter
-	misses   prometheus.Counter
-	errors   prometheus.Counter
-	duration prometheus.Histogram
+// WithCodec overrides Config.Codec.
+func WithCodec(codec Codec) Option {
+	return func(o *options) {
+		o.codec = codec
+	}
+}
+
+// WithMetrics uses m as is, leaving its registration to the caller.
+func WithMetrics(m *Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
 }
 
 type Config struct {
@@ -63,19 +143,99 @@ type Config struct {
 	WriteTimeout time.Duration `yaml:"write_timeout"`
 	PoolSize     int           `yaml:"pool_size"`
 	MinIdleConns int           `yaml:"min_idle_conns"`
+	LoadLockTTL  time.Duration `yaml:"load_lock_ttl"`
+	// LoadTimeout bounds a GetOrLoad load. The load is shared by concurrent
+	// callers, so it runs detached from their contexts. Defaults to 30s.
+	LoadTimeout time.Duration `yaml:"load_timeout"`
+
+	// ClusterAddrs switches to Redis Cluster mode using these seed nodes
+	// instead of Addr.
+	ClusterAddrs  []string `yaml:"cluster_addrs"`
+	ScanBatchSize int      `yaml:"scan_batch_size" validate:"min=0"`
+	// Codec names the codec used for writes ("json", "gob", "msgpack",
+	// "protobuf" or a registered custom codec). Reads detect the codec from
+	// the stored value. Defaults to json.
+	Codec string `yaml:"codec"`
+	// Compression ("gzip" or "flate") is applied to encoded values of at
+	// least CompressionThreshold bytes (default 1024). Compressed values
+	// are detected on read regardless of this setting.
+	Compression          Compression `yaml:"compression" validate:"omitempty,oneof=gzip flate"`
+	CompressionThreshold int         `yaml:"compression_threshold" validate:"min=0"`
+	// NegativeTTL enables caching of not-found results in GetOrLoad: a
+	// loader error with a not-found AppError code stores a tombstone for
+	// this long. Zero disables it.
+	NegativeTTL time.Duration `yaml:"negative_ttl"`
+	// KeyEvents publishes set and delete events for writes made through
+	// the cache, for Subscribe with NotificationChannel.
+	KeyEvents bool `yaml:"key_events"`
 }
 
-func NewRedisCache(config Config, serviceName string) (*RedisCache, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:         config.Addr,
-		Password:     config.Password,
-		DB:           config.DB,
-		DialTimeout:  config.DialTimeout,
-		ReadTimeout:  config.ReadTimeout,
-		WriteTimeout: config.WriteTimeout,
-		PoolSize:     config.PoolSize,
-		MinIdleConns: config.MinIdleConns,
-	})
+const (
+	defaultScanBatchSize = 500
+	defaultLoadTimeout   = 30 * time.Second
+)
+
+func NewRedisCache(config Config, serviceName string, opts ...Option) (*RedisCache, error) {
+	o := options{registerer: prometheus.DefaultRegisterer}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	codec := o.codec
+	if codec == nil {
+		codec = JSONCodec
+		if config.Codec != "" {
+			var err error
+			if codec, err = CodecByName(config.Codec); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var compression byte
+	if config.Compression != CompressionNone {
+		var err error
+		if compression, err = compressionID(config.Compression); err != nil {
+			return nil, err
+		}
+	}
+	compressionThreshold := config.CompressionThreshold
+	if compressionThreshold <= 0 {
+		compressionThreshold = defaultCompressionThreshold
+	}
+
+	metrics := o.metrics
+	if metrics == nil {
+		var err error
+		metrics, err = metricsFor(o.registerer, o.namespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to register cache metrics: %w", err)
+		}
+	}
+
+	var client redis.UniversalClient
+	if len(config.ClusterAddrs) > 0 {
+		client = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        config.ClusterAddrs,
+			Password:     config.Password,
+			DialTimeout:  config.DialTimeout,
+			ReadTimeout:  config.ReadTimeout,
+			WriteTimeout: config.WriteTimeout,
+			PoolSize:     config.PoolSize,
+			MinIdleConns: config.MinIdleConns,
+		})
+	} else {
+		client = redis.NewClient(&redis.Options{
+			Addr:         config.Addr,
+			Password:     config.Password,
+			DB:           config.DB,
+			DialTimeout:  config.DialTimeout,
+			ReadTimeout:  config.ReadTimeout,
+			WriteTimeout: config.WriteTimeout,
+			PoolSize:     config.PoolSize,
+			MinIdleConns: config.MinIdleConns,
+		})
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -84,236 +244,347 @@ func NewRedisCache(config Config, serviceName string) (*RedisCache, error) {
 		return nil, fmt.Errorf("failed to connect to redis: %w", err)
 	}
 
-	metrics := &cacheMetrics{
-		hits: promauto.NewCounter(prometheus.CounterOpts{
-			Name:        "cache_hits_total",
-			Help:        "Total number of cache hits",
-			ConstLabels: prometheus.Labels{"service": serviceName},
-		}),
-		misses: promauto.NewCounter(prometheus.CounterOpts{
-			Name:        "cache_misses_total",
-			Help:        "Total number of cache misses",
-			ConstLabels: prometheus.Labels{"service": serviceName},
-		}),
-		errors: promauto.NewCounter(prometheus.CounterOpts{
-			Name:        "cache_errors_total",
-			Help:        "Total number of cache errors",
-			ConstLabels: prometheus.Labels{"service": serviceName},
-		}),
-		duration: promauto.NewHistogram(prometheus.HistogramOpts{
-			Name:        "cache_operation_duration_seconds",
-			Help:        "Duration of cache operations",
-			ConstLabels: prometheus.Labels{"service": serviceName},
-			Buckets:     prometheus.DefBuckets,
-		}),
+	scanBatchSize := int64(config.ScanBatchSize)
+	if scanBatchSize <= 0 {
+		scanBatchSize = defaultScanBatchSize
+	}
+
+	loadTimeout := config.LoadTimeout
+	if loadTimeout <= 0 {
+		loadTimeout = defaultLoadTimeout
 	}
 
 	return &RedisCache{
-		client:    client,
-		keyPrefix: config.KeyPrefix,
-		metrics:   metrics,
+		client:        client,
+		keyPrefix:     config.KeyPrefix,
+		service:       serviceName,
+		metrics:       metrics,
+		stats:         newMetricsRecorder(time.Now),
+		codec:         codec,
+		loadLockTTL:   config.LoadLockTTL,
+		loadTimeout:   loadTimeout,
+		scanBatchSize: scanBatchSize,
+
+		compressionID:        compression,
+		compressionThreshold: compressionThreshold,
+
+		negativeTTL: config.NegativeTTL,
+		notFound:    o.notFound,
+
+		db:        config.DB,
+		keyEvents: config.KeyEvents,
+
+		keys: NewCacheKeyBuilder(""),
 	}, nil
 }
 
+// Keys returns a key builder for this cache. Its keys are relative to
+// Config.KeyPrefix, which the cache adds itself.
+func (c *RedisCache) Keys() *CacheKeyBuilder {
+	return c.keys
+}
+
+// Metrics returns the Prometheus collector the cache reports to.
+func (c *RedisCache) Metrics() *Metrics {
+	return c.metrics
+}
+
 func (c *RedisCache) Get(ctx context.Context, key string, dest interface{}) error {
+	data, err := c.getBytes(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if err := c.decode(data, dest); err != nil {
+		c.recordError(opGet, key)
+		return fmt.Errorf("cache unmarshal error: %w", err)
+	}
+
+	return nil
+}
+
+func (c *RedisCache) getBytes(ctx context.Context, key string) ([]byte, error) {
 	start := time.Now()
-	defer func() {
-		c.metrics.duration.Observe(time.Since(start).Seconds())
-	}()
 
 	fullKey := c.buildKey(key)
 
-	data, err := c.client.Get(ctx, fullKey).Result()
+	data, err := c.client.Get(ctx, fullKey).Bytes()
+	return c.getResult(ctx, key, start, data, err)
+}
+
+// getBytesWithTTL is getBytes that also returns the remaining TTL of key,
+// read in the same transaction. It follows PTTL: -1 when the key has no TTL.
+func (c *RedisCache) getBytesWithTTL(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	start := time.Now()
+
+	fullKey := c.buildKey(key)
+
+	var get *redis.StringCmd
+	var pttl *redis.DurationCmd
+	// A failed transaction sets its error on every command, so get carries
+	// it.
+	_, _ = c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, fullKey)
+		pttl = pipe.PTTL(ctx, fullKey)
+		return nil
+	})
+
+	data, err := get.Bytes()
+	data, err = c.getResult(ctx, key, start, data, err)
+	return data, pttl.Val(), err
+}
+
+func (c *RedisCache) getResult(ctx context.Context, key string, start time.Time, data []byte, err error) ([]byte, error) {
 	if err != nil {
 		if err == redis.Nil {
-			c.metrics.misses.Inc()
-			return ErrCacheKeyNotFound
+			c.record(opGet, key, start, resultMiss)
+			return nil, ErrCacheKeyNotFound
 		}
-		c.metrics.errors.Inc()
-		return fmt.Errorf("cache get error: %w", err)
+		c.record(opGet, key, start, resultError)
+		return nil, fmt.Errorf("cache get error: %w", err)
 	}
 
-	c.metrics.hits.Inc()
+	c.record(opGet, key, start, resultHit)
 
-	if err := json.Unmarshal([]byte(data), dest); err != nil {
-		c.metrics.errors.Inc()
-		return fmt.Errorf("cache unmarshal error: %w", err)
+	if isTombstone(data) {
+		return nil, c.notFoundError(ctx, key)
 	}
 
-	return nil
+	return data, nil
 }
 
 func (c *RedisCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
-	start := time.Now()
-	defer func() {
-		c.metrics.duration.Observe(time.Since(start).Seconds())
-	}()
-
-	data, err := json.Marshal(value)
+	data, err := c.encode(value)
 	if err != nil {
-		c.metrics.errors.Inc()
+		c.recordError(opSet, key)
 		return fmt.Errorf("cache marshal error: %w", err)
 	}
 
+	return c.setBytes(ctx, key, data, ttl)
+}
+
+func (c *RedisCache) setBytes(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	start := time.Now()
+
 	fullKey := c.buildKey(key)
 
 	if err := c.client.Set(ctx, fullKey, data, ttl).Err(); err != nil {
-		c.metrics.errors.Inc()
+		c.record(opSet, key, start, resultError)
 		return fmt.Errorf("cache set error: %w", err)
 	}
 
-	return nil
-}
-
-func (c *RedisCache) SetWithTags(ctx context.Context, key string, value interface{}, ttl time.Duration, tags []string) error {
-	if err := c.Set(ctx, key, value, ttl); err != nil {
-		return err
-	}
-
-	for _, tag := range tags {
-		if keysInterface, ok := c.tagIndex.Load(tag); ok {
-			if keys, ok := keysInterface.(map[string]bool); ok {
-				keys[key] = true
-				c.tagIndex.Store(tag, keys)
-			}
-		} else {
-			keys := make(map[string]bool)
-			keys[key] = true
-			c.tagIndex.Store(tag, keys)
-		}
-	}
+	c.record(opSet, key, start, resultOK)
+	c.publishKeyEvent(ctx, KeyEventSet, fullKey)
 
 	return nil
 }
 
 func (c *RedisCache) Delete(ctx context.Context, key string) error {
 	start := time.Now()
-	defer func() {
-		c.metrics.duration.Observe(time.Since(start).Seconds())
-	}()
 
 	fullKey := c.buildKey(key)
 
-	if err := c.client.Del(ctx, fullKey).Err(); err != nil {
-		c.metrics.errors.Inc()
+	deleted, err := c.client.Del(ctx, fullKey).Result()
+	if err != nil {
+		c.record(opDelete, key, start, resultError)
 		return fmt.Errorf("cache delete error: %w", err)
 	}
 
+	c.record(opDelete, key, start, resultOK)
+	if deleted > 0 {
+		c.publishKeyEvent(ctx, KeyEventDelete, fullKey)
+	}
+
 	return nil
 }
 
-func (c *RedisCache) DeletePattern(ctx context.Context, pattern string) error {
+// DeletePattern removes every key matching the glob pattern and returns how
+// many were deleted. Keys are found with SCAN and removed with UNLINK in
+// batches of Config.ScanBatchSize, so Redis is never blocked for the whole
+// keyspace. In cluster mode every master is scanned. Cancelling ctx stops
+// the scan; keys deleted so far stay deleted and are counted. The library's
+// own keys, such as held locks, are never matched.
+func (c *RedisCache) DeletePattern(ctx context.Context, pattern string) (int64, error) {
 	start := time.Now()
-	defer func() {
-		c.metrics.duration.Observe(time.Since(start).Seconds())
-	}()
 
 	fullPattern := c.buildKey(pattern)
 
-	keys, err := c.client.Keys(ctx, fullPattern).Result()
+	var deleted atomic.Int64
+	var err error
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return c.unlinkMatching(ctx, node, fullPattern, true, &deleted)
+		})
+	} else {
+		err = c.unlinkMatching(ctx, c.client, fullPattern, false, &deleted)
+	}
+
 	if err != nil {
-		c.metrics.errors.Inc()
-		return fmt.Errorf("cache keys scan error: %w", err)
+		c.record(opDeletePattern, pattern, start, resultError)
+		return deleted.Load(), fmt.Errorf("cache pattern delete error: %w", err)
 	}
 
-	if len(keys) > 0 {
-		if err := c.client.Del(ctx, keys...).Err(); err != nil {
-			c.metrics.errors.Inc()
-			return fmt.Errorf("cache pattern delete error: %w", err)
+	c.record(opDeletePattern, pattern, start, resultOK)
+
+	return deleted.Load(), nil
+}
+
+// unlinkMatching scans a single node. Keys on a cluster node can belong to
+// different hash slots, so they are unlinked one per command in a pipeline
+// there instead of in a single multi-key UNLINK.
+func (c *RedisCache) unlinkMatching(ctx context.Context, node redis.Cmdable, pattern string, perKey bool, deleted *atomic.Int64) error {
+	var cursor uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		keys, next, err := node.Scan(ctx, cursor, pattern, c.scanBatchSize).Result()
+		if err != nil {
+			return fmt.Errorf("scan: %w", err)
+		}
+		keys = slices.DeleteFunc(keys, func(key string) bool {
+			return isInternalKey(c.stripKey(key))
+		})
+
+		if len(keys) > 0 {
+			n, removed, err := c.unlinkKeys(ctx, node, keys, perKey)
+			deleted.Add(n)
+			c.publishKeyEvent(ctx, KeyEventDelete, removed...)
+			if err != nil {
+				return fmt.Errorf("unlink: %w", err)
+			}
 		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
 	}
+}
 
-	return nil
+// unlinkKeys removes keys and returns how many existed. With key events on,
+// keys are unlinked one per command so that it can also return which ones
+// were removed; otherwise removed is nil.
+func (c *RedisCache) unlinkKeys(ctx context.Context, node redis.Cmdable, keys []string, perKey bool) (int64, []string, error) {
+	if !perKey && !c.keyEvents {
+		n, err := node.Unlink(ctx, keys...).Result()
+		return n, nil, err
+	}
+
+	cmds, err := node.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Unlink(ctx, key)
+		}
+		return nil
+	})
+
+	var n int64
+	var removed []string
+	for i, cmd := range cmds {
+		if intCmd, ok := cmd.(*redis.IntCmd); ok && intCmd.Err() == nil && intCmd.Val() > 0 {
+			n += intCmd.Val()
+			removed = append(removed, keys[i])
+		}
+	}
+	return n, removed, err
 }
 
+// Exists reports false for keys holding a tombstone.
 func (c *RedisCache) Exists(ctx context.Context, key string) (bool, error) {
 	start := time.Now()
-	defer func() {
-		c.metrics.duration.Observe(time.Since(start).Seconds())
-	}()
 
 	fullKey := c.buildKey(key)
 
-	exists, err := c.client.Exists(ctx, fullKey).Result()
+	exists, err := existsScript.Run(ctx, c.client, []string{fullKey}, []byte{tombstoneID}).Int64()
 	if err != nil {
-		c.metrics.errors.Inc()
+		c.record(opExists, key, start, resultError)
 		return false, fmt.Errorf("cache exists error: %w", err)
 	}
 
+	c.record(opExists, key, start, resultOK)
+
 	return exists > 0, nil
 }
 
+// GetMetrics returns counters accumulated since the cache was created.
 func (c *RedisCache) GetMetrics() CacheMetrics {
-	return CacheMetrics{}
+	return c.stats.snapshot()
 }
 
-func (c *RedisCache) Warm(ctx context.Context, keys []WarmupKey) error {
-	for _, warmupKey := range keys {
-		if err := c.SetWithTags(ctx, warmupKey.Key, warmupKey.Value, warmupKey.TTL, warmupKey.Tags); err != nil {
-			return fmt.Errorf("cache warmup error for key %s: %w", warmupKey.Key, err)
-		}
-	}
-	return nil
+// WindowMetrics returns counters accumulated since the last ResetMetrics.
+func (c *RedisCache) WindowMetrics() CacheMetrics {
+	return c.stats.windowSnapshot()
 }
 
-func (c *RedisCache) InvalidateByTags(ctx context.Context, tags []string) error {
-	var keysToDelete []string
+// ResetMetrics starts a new metrics window and returns the one it closed.
+// Lifetime metrics and Prometheus counters are unaffected.
+func (c *RedisCache) ResetMetrics() CacheMetrics {
+	return c.stats.resetWindow()
+}
 
-	for _, tag := range tags {
-		if keysInterface, ok := c.tagIndex.Load(tag); ok {
-			if keys, ok := keysInterface.(map[string]bool); ok {
-				for key := range keys {
-					keysToDelete = append(keysToDelete, key)
-				}
-				c.tagIndex.Delete(tag)
-			}
-		}
-	}
+// record reports a finished operation to Prometheus and to the per-instance
+// counters behind GetMetrics.
+func (c *RedisCache) record(op, key string, start time.Time, result opResult) {
+	duration := time.Since(start)
+	c.metrics.duration.WithLabelValues(c.service, op).Observe(duration.Seconds())
+	c.metrics.operations.WithLabelValues(c.service, op, result.String()).Inc()
 
-	for _, key := range keysToDelete {
-		if err := c.Delete(ctx, key); err != nil {
-			return fmt.Errorf("cache invalidation error for key %s: %w", key, err)
-		}
-	}
+	c.stats.record(op, key, result, duration)
+}
 
-	return nil
+func (c *RedisCache) recordError(op, key string) {
+	c.metrics.operations.WithLabelValues(c.service, op, resultError.String()).Inc()
+	c.stats.recordError(op, key)
 }
 
-func (c *RedisCache) buildKey(key string) string {
-	if c.keyPrefix == "" {
-		return key
+// encode serializes value and compresses it when it is large enough and
+// compression actually makes it smaller.
+func (c *RedisCache) encode(value interface{}) ([]byte, error) {
+	data, err := encodeValue(c.codec, value)
+	if err != nil || c.compressionID == 0 || len(data) < c.compressionThreshold {
+		return data, err
 	}
-	return c.keyPrefix + ":" + key
-}
 
-var (
-	ErrCacheKeyNotFound = fmt.Errorf("cache key not found")
-)
+	compressed, err := compress(c.compressionID, data)
+	if err != nil {
+		return nil, fmt.Errorf("compress: %w", err)
+	}
 
-type CacheKeyBuilder struct {
-	prefix string
-}
+	ratio := float64(len(data)) / float64(len(compressed))
+	c.metrics.compressionRatio.WithLabelValues(c.service).Observe(ratio)
+	c.stats.recordCompression(len(data), len(compressed))
 
-func NewCacheKeyBuilder(prefix string) *CacheKeyBuilder {
-	return &CacheKeyBuilder{prefix: prefix}
+	if len(compressed) >= len(data) {
+		return data, nil
+	}
+	return compressed, nil
 }
 
-func (b *CacheKeyBuilder) UserKey(userID string) string {
-	return fmt.Sprintf("%s:user:%s", b.prefix, userID)
+func (c *RedisCache) decode(data []byte, dest interface{}) error {
+	return decodeValue(data, dest)
 }
 
-func (b *CacheKeyBuilder) TestKey(testID string) string {
-	return fmt.Sprintf("%s:test:%s", b.prefix, testID)
+func (c *RedisCache) buildKey(key string) string {
+	if c.keyPrefix == "" {
+		return key
+	}
+	return c.keyPrefix + ":" + key
 }
 
-func (b *CacheKeyBuilder) UserTestsKey(userID string) string {
-	return fmt.Sprintf("%s:user:%s:tests", b.prefix, userID)
-}
+// internalKeyPrefix starts, after Config.KeyPrefix, every key the library
+// keeps for itself: tag indexes and locks. DeletePattern leaves them alone
+// and subscriptions do not report them.
+const internalKeyPrefix = "__cache:"
 
-func (b *CacheKeyBuilder) LeaderboardKey(category string) string {
-	return fmt.Sprintf("%s:leaderboard:%s", b.prefix, category)
+// stripKey is the inverse of buildKey.
+func (c *RedisCache) stripKey(fullKey string) string {
+	if c.keyPrefix == "" {
+		return fullKey
+	}
+	return strings.TrimPrefix(fullKey, c.keyPrefix+":")
 }
 
-func (b *CacheKeyBuilder) StatsKey(userID string, period string) string {
-	return fmt.Sprintf("%s:stats:%s:%s", b.prefix, userID, period)
-}
+var (
+	ErrCacheKeyNotFound = fmt.Errorf("cache key not found")
+)
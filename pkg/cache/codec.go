@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec serializes cache values. Stored values start with the codec's ID so
+// a cache can read entries written with any registered codec, which lets a
+// service switch codecs without flushing the cache.
+type Codec interface {
+	// ID is the header byte identifying the codec. It must be between 0x01
+	// and 0x08, a range no JSON document starts with, so headerless values
+	// written before codecs existed are still read as JSON.
+	ID() byte
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+const (
+	codecIDJSON    byte = 0x01
+	codecIDGob     byte = 0x02
+	codecIDMsgpack byte = 0x03
+	codecIDProto   byte = 0x04
+
+	maxCodecID byte = 0x08
+)
+
+var (
+	JSONCodec    Codec = jsonCodec{}
+	GobCodec     Codec = gobCodec{}
+	MsgpackCodec Codec = msgpackCodec{}
+	ProtoCodec   Codec = protoCodec{}
+)
+
+var (
+	codecsMu     sync.RWMutex
+	codecsByID   = make(map[byte]Codec)
+	codecsByName = make(map[string]Codec)
+)
+
+func init() {
+	for _, codec := range []Codec{JSONCodec, GobCodec, MsgpackCodec, ProtoCodec} {
+		if err := RegisterCodec(codec); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterCodec makes a custom codec available by name in Config.Codec and
+// for decoding values that carry its ID.
+func RegisterCodec(codec Codec) error {
+	id := codec.ID()
+	if id == 0 || id > maxCodecID {
+		return fmt.Errorf("codec %s: id %#x out of range", codec.Name(), id)
+	}
+
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	if existing, ok := codecsByID[id]; ok {
+		return fmt.Errorf("codec %s: id %#x already used by %s", codec.Name(), id, existing.Name())
+	}
+	codecsByID[id] = codec
+	codecsByName[codec.Name()] = codec
+	return nil
+}
+
+func CodecByName(name string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	codec, ok := codecsByName[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown cache codec %q", name)
+	}
+	return codec, nil
+}
+
+func codecByID(id byte) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	codec, ok := codecsByID[id]
+	return codec, ok
+}
+
+// encodeValue serializes v with codec and prepends the codec header.
+func encodeValue(codec Codec, v interface{}) ([]byte, error) {
+	payload, err := codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, len(payload)+1)
+	data = append(data, codec.ID())
+	return append(data, payload...), nil
+}
+
+// decodeValue strips a stale-while-revalidate envelope and decompresses data
+// if needed, then picks the codec from the header byte, falling back to JSON
+// for values without one.
+func decodeValue(data []byte, v interface{}) error {
+	if entry, ok := decodeSWR(data); ok {
+		data = entry.value
+	}
+
+	if isCompressed(data) {
+		var err error
+		if data, err = decompress(data); err != nil {
+			return fmt.Errorf("decompress: %w", err)
+		}
+	}
+
+	if len(data) > 0 && data[0] <= maxCodecID {
+		codec, ok := codecByID(data[0])
+		if !ok {
+			return fmt.Errorf("unknown cache codec id %#x", data[0])
+		}
+		return codec.Unmarshal(data[1:], v)
+	}
+	return json.Unmarshal(data, v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ID() byte     { return codecIDJSON }
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) ID() byte     { return codecIDGob }
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// msgpackCodec honours `json` struct tags so types need no extra tags to
+// switch from the JSON codec.
+type msgpackCodec struct{}
+
+func (msgpackCodec) ID() byte     { return codecIDMsgpack }
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+type protoCodec struct{}
+
+func (protoCodec) ID() byte     { return codecIDProto }
+func (protoCodec) Name() string { return "protobuf" }
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(msg)
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, msg)
+}
@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type codecValue struct {
+	Name  string   `json:"name"`
+	Tags  []string `json:"tags"`
+	Count int      `json:"count"`
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	value := codecValue{Name: strings.Repeat("cached ", 200), Tags: []string{"a", "b"}, Count: 3}
+
+	tests := []struct {
+		name        string
+		codec       Codec
+		compression byte
+	}{
+		{"json", JSONCodec, 0},
+		{"gob", GobCodec, 0},
+		{"msgpack", MsgpackCodec, 0},
+		{"json gzip", JSONCodec, compressionIDGzip},
+		{"gob gzip", GobCodec, compressionIDGzip},
+		{"msgpack flate", MsgpackCodec, compressionIDFlate},
+		{"json flate", JSONCodec, compressionIDFlate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := encodeValue(tt.codec, value)
+			if err != nil {
+				t.Fatalf("encodeValue: %v", err)
+			}
+			if data[0] != tt.codec.ID() {
+				t.Fatalf("header = %#x, want codec id %#x", data[0], tt.codec.ID())
+			}
+			if tt.compression != 0 {
+				if data, err = compress(tt.compression, data); err != nil {
+					t.Fatalf("compress: %v", err)
+				}
+				if data[0] != tt.compression || !isCompressed(data) {
+					t.Fatalf("header = %#x, want compression id %#x", data[0], tt.compression)
+				}
+			}
+
+			framings := map[string][]byte{
+				"plain": data,
+				"swr":   encodeSWR(swrEntry{softExpiry: time.UnixMilli(1715000000000), delta: time.Second, value: data}),
+			}
+			for framing, framed := range framings {
+				var got codecValue
+				if err := decodeValue(framed, &got); err != nil {
+					t.Fatalf("%s: decodeValue: %v", framing, err)
+				}
+				if !reflect.DeepEqual(got, value) {
+					t.Fatalf("%s: got %+v, want %+v", framing, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestProtoCodecRoundTrip(t *testing.T) {
+	for _, compression := range []byte{0, compressionIDGzip, compressionIDFlate} {
+		value := wrapperspb.String(strings.Repeat("proto ", 100))
+		data, err := encodeValue(ProtoCodec, value)
+		if err != nil {
+			t.Fatalf("encodeValue: %v", err)
+		}
+		if compression != 0 {
+			if data, err = compress(compression, data); err != nil {
+				t.Fatalf("compress: %v", err)
+			}
+		}
+
+		got := &wrapperspb.StringValue{}
+		if err := decodeValue(data, got); err != nil {
+			t.Fatalf("compression %#x: decodeValue: %v", compression, err)
+		}
+		if !proto.Equal(got, value) {
+			t.Fatalf("compression %#x: got %v, want %v", compression, got, value)
+		}
+	}
+
+	if _, err := encodeValue(ProtoCodec, codecValue{}); err == nil {
+		t.Error("encoding a non-proto value succeeded")
+	}
+}
+
+func TestDecodeValueHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    interface{}
+		wantErr bool
+	}{
+		{"headerless object", []byte(`{"name":"legacy","count":1}`), codecValue{Name: "legacy", Count: 1}, false},
+		{"headerless string", []byte(`"legacy"`), "legacy", false},
+		{"headerless number", []byte(`42`), float64(42), false},
+		{"unknown codec", []byte{0x07, '{', '}'}, nil, true},
+		{"unknown compression", []byte{compressedFlag | 0x05, 0x00}, nil, true},
+		{"corrupt gzip", []byte{compressionIDGzip, 0x00, 0x01}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dest interface{}
+			if tt.want != nil {
+				dest = reflect.New(reflect.TypeOf(tt.want)).Interface()
+			} else {
+				dest = &codecValue{}
+			}
+
+			err := decodeValue(tt.data, dest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeValue error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.want != nil {
+				if got := reflect.ValueOf(dest).Elem().Interface(); !reflect.DeepEqual(got, tt.want) {
+					t.Fatalf("got %#v, want %#v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestHeaderRangesDisjoint(t *testing.T) {
+	tombstone := []byte{tombstoneID}
+	if !isTombstone(tombstone) {
+		t.Fatal("tombstone not recognised")
+	}
+	if isCompressed(tombstone) || tombstoneID <= maxCodecID || tombstoneID == swrEnvelopeID {
+		t.Fatalf("tombstone id %#x overlaps another header range", tombstoneID)
+	}
+	if _, ok := decodeSWR(tombstone); ok {
+		t.Fatal("tombstone decoded as an SWR envelope")
+	}
+
+	for _, id := range []byte{codecIDJSON, codecIDGob, codecIDMsgpack, codecIDProto} {
+		if id > maxCodecID || id&compressedFlag != 0 || id == swrEnvelopeID {
+			t.Errorf("codec id %#x overlaps another header range", id)
+		}
+	}
+	if swrEnvelopeID <= maxCodecID || swrEnvelopeID&compressedFlag != 0 {
+		t.Errorf("swr envelope id %#x overlaps another header range", swrEnvelopeID)
+	}
+	for _, id := range []byte{'{', '[', '"', 't', 'f', 'n', '-', '0', '9', ' '} {
+		if id <= maxCodecID || id&compressedFlag != 0 || id == swrEnvelopeID || id == tombstoneID {
+			t.Errorf("JSON start byte %q overlaps a header", id)
+		}
+	}
+}
+
+type testCodec struct {
+	id byte
+}
+
+func (c testCodec) ID() byte                          { return c.id }
+func (c testCodec) Name() string                      { return "test" }
+func (testCodec) Marshal(interface{}) ([]byte, error) { return nil, nil }
+func (testCodec) Unmarshal([]byte, interface{}) error { return nil }
+
+func TestRegisterCodecRejectsBadIDs(t *testing.T) {
+	for _, id := range []byte{0x00, codecIDJSON, maxCodecID + 1, compressionIDGzip} {
+		if err := RegisterCodec(testCodec{id: id}); err == nil {
+			t.Errorf("RegisterCodec accepted id %#x", id)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Compressed values start with a header byte with the high bit set, which
+// neither codec IDs nor JSON documents use. The rest is the compressed
+// codec-framed value.
+const compressedFlag byte = 0x80
+
+type Compression string
+
+const (
+	CompressionNone  Compression = ""
+	CompressionGzip  Compression = "gzip"
+	CompressionFlate Compression = "flate"
+)
+
+const (
+	compressionIDGzip  = compressedFlag | 0x01
+	compressionIDFlate = compressedFlag | 0x02
+)
+
+const defaultCompressionThreshold = 1024
+
+var (
+	gzipWriters  = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+	flateWriters = sync.Pool{New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	}}
+)
+
+func compressionID(compression Compression) (byte, error) {
+	switch compression {
+	case CompressionGzip:
+		return compressionIDGzip, nil
+	case CompressionFlate:
+		return compressionIDFlate, nil
+	default:
+		return 0, fmt.Errorf("unknown cache compression %q", compression)
+	}
+}
+
+// compress returns data compressed and framed with header id.
+func compress(id byte, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(len(data)/2 + 1)
+	buf.WriteByte(id)
+
+	switch id {
+	case compressionIDGzip:
+		w := gzipWriters.Get().(*gzip.Writer)
+		defer gzipWriters.Put(w)
+		w.Reset(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case compressionIDFlate:
+		w := flateWriters.Get().(*flate.Writer)
+		defer flateWriters.Put(w)
+		w.Reset(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown cache compression id %#x", id)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func isCompressed(data []byte) bool {
+	return len(data) > 0 && data[0]&compressedFlag != 0
+}
+
+func decompress(data []byte) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+
+	switch data[0] {
+	case compressionIDGzip:
+		r, err = gzip.NewReader(bytes.NewReader(data[1:]))
+		if err != nil {
+			return nil, err
+		}
+	case compressionIDFlate:
+		r = flate.NewReader(bytes.NewReader(data[1:]))
+	default:
+		return nil, fmt.Errorf("unknown cache compression id %#x", data[0])
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
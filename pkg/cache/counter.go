@@ -0,0 +1,238 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type CounterOptions struct {
+	// Period starts a new bucket every period. Defaults to PeriodAllTime.
+	Period Period
+	// Retention keeps a bucket for this long after its period ends.
+	// Defaults to one period.
+	Retention time.Duration
+	Clock     Clock
+}
+
+func (o *CounterOptions) setDefaults() error {
+	if !o.Period.Valid() {
+		return fmt.Errorf("invalid counter period %q", o.Period)
+	}
+	if o.Retention <= 0 {
+		o.Retention = o.Period.length()
+	}
+	if o.Clock == nil {
+		o.Clock = systemClock{}
+	}
+	return nil
+}
+
+// CounterBucket is one period of a rollup.
+type CounterBucket struct {
+	Start  time.Time
+	Bucket string
+	Value  int64
+}
+
+// Counter is an atomic INCRBY counter split into period buckets, each
+// expiring on its own, e.g. "<prefix>:counter:logins:daily:2024-05-06".
+type Counter struct {
+	cache *RedisCache
+	key   string
+	opts  CounterOptions
+}
+
+func NewCounter(cache *RedisCache, name string, opts CounterOptions) (*Counter, error) {
+	if err := opts.setDefaults(); err != nil {
+		return nil, err
+	}
+	return &Counter{cache: cache, key: "counter:" + name, opts: opts}, nil
+}
+
+// Incr adds n to the current bucket and returns its new value.
+func (c *Counter) Incr(ctx context.Context, n int64) (int64, error) {
+	now := c.opts.Clock.Now()
+	key := c.bucketKey(now)
+
+	var cmd *redis.IntCmd
+	err := incrBucket(ctx, c.cache, key, c.opts.Period.expireAt(now, c.opts.Retention), func(pipe redis.Pipeliner, fullKey string) {
+		cmd = pipe.IncrBy(ctx, fullKey, n)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return cmd.Val(), nil
+}
+
+// Get returns the current bucket's value.
+func (c *Counter) Get(ctx context.Context) (int64, error) {
+	return c.Sum(ctx, c.opts.Clock.Now(), c.opts.Clock.Now())
+}
+
+// Sum adds up the buckets from the one containing from to the one
+// containing to. Expired buckets count as zero.
+func (c *Counter) Sum(ctx context.Context, from, to time.Time) (int64, error) {
+	series, err := c.Series(ctx, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, bucket := range series {
+		total += bucket.Value
+	}
+	return total, nil
+}
+
+// Series returns every bucket from the one containing from to the one
+// containing to, in order, fetched in one round trip.
+func (c *Counter) Series(ctx context.Context, from, to time.Time) ([]CounterBucket, error) {
+	start := time.Now()
+	starts := c.opts.Period.starts(from, to)
+
+	cmds := make([]*redis.StringCmd, len(starts))
+	_, err := c.cache.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, bucketStart := range starts {
+			cmds[i] = pipe.Get(ctx, c.cache.buildKey(c.bucketKey(bucketStart)))
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		c.cache.record(opCounter, c.key, start, resultError)
+		return nil, fmt.Errorf("counter read error: %w", err)
+	}
+	c.cache.record(opCounter, c.key, start, resultOK)
+
+	series := make([]CounterBucket, len(starts))
+	for i, bucketStart := range starts {
+		value, err := cmds[i].Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("counter read error: %w", err)
+		}
+		series[i] = CounterBucket{Start: bucketStart, Bucket: c.opts.Period.Bucket(bucketStart), Value: value}
+	}
+	return series, nil
+}
+
+func (c *Counter) bucketKey(t time.Time) string {
+	if c.opts.Period == PeriodAllTime {
+		return c.key
+	}
+	return fmt.Sprintf("%s:%s:%s", c.key, c.opts.Period, c.opts.Period.Bucket(t))
+}
+
+// Stats is a set of named HINCRBY counters for one user, stored as a hash
+// per bucket under CacheKeyBuilder.StatsKey(userID, "<period>:<bucket>").
+type Stats struct {
+	cache  *RedisCache
+	keys   *CacheKeyBuilder
+	userID string
+	opts   CounterOptions
+}
+
+func NewStats(cache *RedisCache, userID string, opts CounterOptions) (*Stats, error) {
+	if err := opts.setDefaults(); err != nil {
+		return nil, err
+	}
+	return &Stats{cache: cache, keys: cache.Keys(), userID: userID, opts: opts}, nil
+}
+
+// Incr adds n to field in the current bucket and returns its new value.
+func (s *Stats) Incr(ctx context.Context, field string, n int64) (int64, error) {
+	now := s.opts.Clock.Now()
+
+	var cmd *redis.IntCmd
+	err := incrBucket(ctx, s.cache, s.bucketKey(now), s.opts.Period.expireAt(now, s.opts.Retention), func(pipe redis.Pipeliner, fullKey string) {
+		cmd = pipe.HIncrBy(ctx, fullKey, field, n)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return cmd.Val(), nil
+}
+
+// IncrMany adds to several fields of the current bucket atomically.
+func (s *Stats) IncrMany(ctx context.Context, deltas map[string]int64) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+	now := s.opts.Clock.Now()
+
+	return incrBucket(ctx, s.cache, s.bucketKey(now), s.opts.Period.expireAt(now, s.opts.Retention), func(pipe redis.Pipeliner, fullKey string) {
+		for field, n := range deltas {
+			pipe.HIncrBy(ctx, fullKey, field, n)
+		}
+	})
+}
+
+// Get returns every field of the current bucket.
+func (s *Stats) Get(ctx context.Context) (map[string]int64, error) {
+	return s.Rollup(ctx, s.opts.Clock.Now(), s.opts.Clock.Now())
+}
+
+// Rollup sums each field over the buckets from the one containing from to
+// the one containing to.
+func (s *Stats) Rollup(ctx context.Context, from, to time.Time) (map[string]int64, error) {
+	start := time.Now()
+	starts := s.opts.Period.starts(from, to)
+	key := s.keys.StatsKey(s.userID, "")
+
+	cmds := make([]*redis.StringStringMapCmd, len(starts))
+	_, err := s.cache.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, bucketStart := range starts {
+			cmds[i] = pipe.HGetAll(ctx, s.cache.buildKey(s.bucketKey(bucketStart)))
+		}
+		return nil
+	})
+	if err != nil {
+		s.cache.record(opCounter, key, start, resultError)
+		return nil, fmt.Errorf("stats read error: %w", err)
+	}
+	s.cache.record(opCounter, key, start, resultOK)
+
+	totals := make(map[string]int64)
+	for _, cmd := range cmds {
+		for field, raw := range cmd.Val() {
+			value, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("stats field %s: %w", field, err)
+			}
+			totals[field] += value
+		}
+	}
+	return totals, nil
+}
+
+func (s *Stats) bucketKey(t time.Time) string {
+	if s.opts.Period == PeriodAllTime {
+		return s.keys.StatsKey(s.userID, "all")
+	}
+	return s.keys.StatsKey(s.userID, fmt.Sprintf("%s:%s", s.opts.Period, s.opts.Period.Bucket(t)))
+}
+
+// incrBucket runs the increments queued by cmd and sets the bucket's expiry
+// in one transaction, so a bucket never exists without its TTL.
+func incrBucket(ctx context.Context, cache *RedisCache, key string, expireAt time.Time, cmd func(pipe redis.Pipeliner, fullKey string)) error {
+	start := time.Now()
+	fullKey := cache.buildKey(key)
+
+	_, err := cache.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		cmd(pipe, fullKey)
+		if !expireAt.IsZero() {
+			pipe.ExpireAt(ctx, fullKey, expireAt)
+		}
+		return nil
+	})
+	if err != nil {
+		cache.record(opCounter, key, start, resultError)
+		return fmt.Errorf("counter update error: %w", err)
+	}
+
+	cache.record(opCounter, key, start, resultOK)
+	return nil
+}
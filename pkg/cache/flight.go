@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// flightGroup deduplicates concurrent calls for the same key so that only
+// one of them runs fn and the rest wait for and share its result.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done  chan struct{}
+	val   []byte
+	err   error
+	panic *flightPanic
+}
+
+// flightPanic is a panic recovered from fn. It is re-raised in every caller
+// waiting on the call, so it reaches their recovery code rather than
+// crashing the process from fn's goroutine.
+type flightPanic struct {
+	value interface{}
+	stack []byte
+}
+
+func (p *flightPanic) Error() string {
+	return fmt.Sprintf("cache loader panic: %v\n\n%s", p.value, p.stack)
+}
+
+func (p *flightPanic) Unwrap() error {
+	err, _ := p.value.(error)
+	return err
+}
+
+// Do runs fn in its own goroutine, once for all concurrent calls with the
+// same key, and waits for its result until ctx is done. A caller giving up
+// does not stop fn for the others, so fn should not use any one caller's
+// context and must bound itself. If fn panics, Do panics with a
+// *flightPanic in every caller still waiting.
+func (g *flightGroup) Do(ctx context.Context, key string, fn func() ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	call, ok := g.calls[key]
+	if !ok {
+		call = &flightCall{done: make(chan struct{})}
+		g.calls[key] = call
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					call.panic = &flightPanic{value: r, stack: debug.Stack()}
+				}
+
+				g.mu.Lock()
+				delete(g.calls, key)
+				g.mu.Unlock()
+				close(call.done)
+			}()
+			call.val, call.err = fn()
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		if call.panic != nil {
+			panic(call.panic)
+		}
+		return call.val, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,54 @@
+package cache
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"user:1", "user:1", true},
+		{"user:1", "user:10", false},
+
+		{"*", "", true},
+		{"*", "user:1:tests", true},
+		{"user:*", "user:1:tests", true},
+		{"user:*", "user", false},
+		{"*:tests", "user:1:tests", true},
+		{"a**b", "ab", true},
+		{"*a", "bbb", false},
+		{"*a*b*", "xaybz", true},
+
+		{"?", "", false},
+		{"user:?", "user:1", true},
+		{"user:?", "user:10", false},
+
+		{"[abc]", "b", true},
+		{"[abc]", "d", false},
+		{"[abc]", "", false},
+		{"[^a]", "b", true},
+		{"[^a]", "a", false},
+		{"[a-z]", "m", true},
+		{"[a-z]", "M", false},
+		{"[z-a]", "m", true},
+		{"[a-]", "-", true},
+		{"[\\]]", "]", true},
+		{"[abc", "[abc", true},
+		{"[abc", "a", false},
+
+		{"\\*", "*", true},
+		{"\\*", "a", false},
+		{"user\\?", "user?", true},
+		{"user\\?", "user1", false},
+		{"a\\", "a\\", true},
+	}
+
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultMaxSegmentLength = 128
+	defaultMaxKeyLength     = 512
+
+	// hashedSegmentMarker starts segments replaced by their hash. It is
+	// escaped in ordinary segments, so the two never collide.
+	hashedSegmentMarker = "#"
+)
+
+// keyEscaper percent-encodes characters that would split a key into
+// segments or act as glob syntax in DeletePattern.
+var keyEscaper = strings.NewReplacer(
+	"%", "%25",
+	":", "%3A",
+	"*", "%2A",
+	"?", "%3F",
+	"[", "%5B",
+	"]", "%5D",
+	"\\", "%5C",
+	"#", "%23",
+)
+
+// EscapeKeySegment makes s safe to use as a single key segment.
+func EscapeKeySegment(s string) string {
+	return keyEscaper.Replace(s)
+}
+
+// KeyBuilder builds keys of the form "<prefix>:<namespace>[:v<version>]:<segments...>"
+// from registered namespaces. Segments are escaped and long ones hashed, so
+// IDs from user input cannot produce ambiguous or oversized keys.
+//
+// RedisCache adds its own Config.KeyPrefix to every key, so builders for keys
+// passed to a cache should have an empty prefix; RedisCache.Keys returns one.
+type KeyBuilder struct {
+	prefix           string
+	maxSegmentLength int
+	maxKeyLength     int
+
+	mu         sync.RWMutex
+	namespaces map[string]*Namespace
+}
+
+type KeyBuilderOption func(*KeyBuilder)
+
+// WithMaxSegmentLength hashes segments longer than n bytes after escaping.
+// Defaults to 128.
+func WithMaxSegmentLength(n int) KeyBuilderOption {
+	return func(b *KeyBuilder) {
+		b.maxSegmentLength = n
+	}
+}
+
+// WithMaxKeyLength hashes everything after the namespace and version of keys
+// longer than n bytes. Defaults to 512.
+func WithMaxKeyLength(n int) KeyBuilderOption {
+	return func(b *KeyBuilder) {
+		b.maxKeyLength = n
+	}
+}
+
+func NewKeyBuilder(prefix string, opts ...KeyBuilderOption) *KeyBuilder {
+	b := &KeyBuilder{
+		prefix:           prefix,
+		maxSegmentLength: defaultMaxSegmentLength,
+		maxKeyLength:     defaultMaxKeyLength,
+		namespaces:       make(map[string]*Namespace),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Register adds a namespace. A version above zero adds a "v<version>"
+// segment, so bumping it moves every key of the namespace and leaves the old
+// entries to expire.
+func (b *KeyBuilder) Register(name string, version int) (*Namespace, error) {
+	if name == "" || EscapeKeySegment(name) != name {
+		return nil, fmt.Errorf("invalid key namespace %q", name)
+	}
+	if version < 0 {
+		return nil, fmt.Errorf("key namespace %s: negative version %d", name, version)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.namespaces[name]; ok {
+		return nil, fmt.Errorf("key namespace %s already registered", name)
+	}
+	ns := &Namespace{builder: b, name: name, version: version}
+	b.namespaces[name] = ns
+	return ns, nil
+}
+
+// MustRegister is like Register but panics on error, for package-level
+// namespace declarations.
+func (b *KeyBuilder) MustRegister(name string, version int) *Namespace {
+	ns, err := b.Register(name, version)
+	if err != nil {
+		panic(err)
+	}
+	return ns
+}
+
+func (b *KeyBuilder) Namespace(name string) (*Namespace, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	ns, ok := b.namespaces[name]
+	return ns, ok
+}
+
+type Namespace struct {
+	builder *KeyBuilder
+	name    string
+	version int
+}
+
+func (n *Namespace) Name() string {
+	return n.name
+}
+
+func (n *Namespace) Version() int {
+	return n.version
+}
+
+// Key joins the escaped segments under the namespace.
+func (n *Namespace) Key(segments ...string) string {
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = n.builder.segment(segment)
+	}
+	return n.join(escaped)
+}
+
+// Pattern matches every key under the given segments, for DeletePattern.
+func (n *Namespace) Pattern(segments ...string) string {
+	if len(segments) == 0 {
+		return n.join([]string{"*"})
+	}
+	return n.Key(segments...) + ":*"
+}
+
+func (n *Namespace) join(segments []string) string {
+	head := n.name
+	if n.builder.prefix != "" {
+		head = n.builder.prefix + ":" + head
+	}
+	if n.version > 0 {
+		head += ":v" + strconv.Itoa(n.version)
+	}
+	if len(segments) == 0 {
+		return head
+	}
+
+	tail := strings.Join(segments, ":")
+	if len(head)+1+len(tail) > n.builder.maxKeyLength {
+		tail = hashSegment(tail)
+	}
+	return head + ":" + tail
+}
+
+func (b *KeyBuilder) segment(s string) string {
+	escaped := EscapeKeySegment(s)
+	if len(escaped) > b.maxSegmentLength {
+		return hashSegment(escaped)
+	}
+	return escaped
+}
+
+func hashSegment(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hashedSegmentMarker + hex.EncodeToString(sum[:16])
+}
+
+// KeyTemplate builds keys for values of type T, so call sites pass a typed
+// ID instead of assembling segments by hand.
+type KeyTemplate[T any] struct {
+	namespace *Namespace
+	segments  func(T) []string
+}
+
+func NewKeyTemplate[T any](namespace *Namespace, segments func(T) []string) *KeyTemplate[T] {
+	return &KeyTemplate[T]{namespace: namespace, segments: segments}
+}
+
+func (t *KeyTemplate[T]) Key(v T) string {
+	return t.namespace.Key(t.segments(v)...)
+}
+
+func (t *KeyTemplate[T]) Namespace() *Namespace {
+	return t.namespace
+}
+
+// CacheKeyBuilder builds the shared keys used across services. Use
+// RedisCache.Keys for keys passed to a cache with a KeyPrefix.
+type CacheKeyBuilder struct {
+	keys        *KeyBuilder
+	user        *Namespace
+	test        *Namespace
+	leaderboard *Namespace
+	stats       *Namespace
+}
+
+func NewCacheKeyBuilder(prefix string) *CacheKeyBuilder {
+	keys := NewKeyBuilder(prefix)
+	return &CacheKeyBuilder{
+		keys:        keys,
+		user:        keys.MustRegister("user", 0),
+		test:        keys.MustRegister("test", 0),
+		leaderboard: keys.MustRegister("leaderboard", 0),
+		stats:       keys.MustRegister("stats", 0),
+	}
+}
+
+// Keys returns the underlying builder, for registering service-specific
+// namespaces under the same prefix.
+func (b *CacheKeyBuilder) Keys() *KeyBuilder {
+	return b.keys
+}
+
+func (b *CacheKeyBuilder) UserKey(userID string) string {
+	return b.user.Key(userID)
+}
+
+func (b *CacheKeyBuilder) TestKey(testID string) string {
+	return b.test.Key(testID)
+}
+
+func (b *CacheKeyBuilder) UserTestsKey(userID string) string {
+	return b.user.Key(userID, "tests")
+}
+
+func (b *CacheKeyBuilder) LeaderboardKey(category string) string {
+	return b.leaderboard.Key(category)
+}
+
+// StatsKey escapes userID but not period, which may span several segments
+// (e.g. "daily:2024-05-06").
+func (b *CacheKeyBuilder) StatsKey(userID string, period string) string {
+	return b.stats.Key(userID) + ":" + period
+}
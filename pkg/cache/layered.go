@@ -0,0 +1,420 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type LayeredConfig struct {
+	// MaxEntries bounds L1. Defaults to 10000.
+	MaxEntries int `yaml:"max_entries" validate:"min=0"`
+	// TTL bounds how long L1 keeps a value, never past its expiry in L2.
+	// Defaults to 1m.
+	TTL                 time.Duration `yaml:"ttl" validate:"min=0"`
+	InvalidationChannel string        `yaml:"invalidation_channel"`
+}
+
+const (
+	defaultLayeredTTL          = time.Minute
+	defaultLayeredMaxEntries   = 10000
+	defaultInvalidationChannel = "__invalidate"
+)
+
+// LayeredCache serves reads from a bounded in-process LRU (L1) in front of a
+// RedisCache (L2). Writes and deletes go to L2 and are broadcast over Redis
+// pub/sub so every instance drops the affected keys from its L1.
+type LayeredCache struct {
+	l1         *lru
+	l2         *RedisCache
+	ttl        time.Duration
+	channel    string
+	instanceID string
+
+	// fillMu and generation keep a value read from L2 out of L1 when an
+	// invalidation ran while it was being read.
+	fillMu     sync.Mutex
+	generation uint64
+
+	l1Hits   atomic.Int64
+	l1Misses atomic.Int64
+	l1Hit    prometheus.Counter
+	l2Hit    prometheus.Counter
+
+	pubsub *redis.PubSub
+	done   chan struct{}
+	once   sync.Once
+}
+
+type invalidationMessage struct {
+	Origin  string   `json:"origin"`
+	Keys    []string `json:"keys,omitempty"`
+	Pattern string   `json:"pattern,omitempty"`
+}
+
+func NewLayeredCache(l2 *RedisCache, config LayeredConfig, serviceName string) (*LayeredCache, error) {
+	ttl := config.TTL
+	if ttl <= 0 {
+		ttl = defaultLayeredTTL
+	}
+
+	maxEntries := config.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultLayeredMaxEntries
+	}
+
+	channel := config.InvalidationChannel
+	if channel == "" {
+		channel = l2.buildKey(defaultInvalidationChannel)
+	}
+
+	instanceID, err := newLockToken()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &LayeredCache{
+		l1:         newLRU(maxEntries, time.Now),
+		l2:         l2,
+		ttl:        ttl,
+		channel:    channel,
+		instanceID: instanceID,
+		l1Hit:      l2.metrics.layerHits.WithLabelValues(serviceName, "l1"),
+		l2Hit:      l2.metrics.layerHits.WithLabelValues(serviceName, "l2"),
+		done:       make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c.pubsub = l2.client.Subscribe(ctx, channel)
+	if _, err := c.pubsub.Receive(ctx); err != nil {
+		_ = c.pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe to invalidation channel: %w", err)
+	}
+
+	go c.listen()
+
+	return c, nil
+}
+
+func (c *LayeredCache) listen() {
+	defer close(c.done)
+
+	for msg := range c.pubsub.Channel() {
+		var inv invalidationMessage
+		if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+			continue
+		}
+		if inv.Origin == c.instanceID {
+			continue
+		}
+		c.evict(inv)
+	}
+}
+
+func (c *LayeredCache) evict(inv invalidationMessage) {
+	c.fillMu.Lock()
+	defer c.fillMu.Unlock()
+
+	c.generation++
+	for _, key := range inv.Keys {
+		c.l1.delete(key)
+	}
+	if inv.Pattern != "" {
+		c.l1.deleteMatching(inv.Pattern)
+	}
+}
+
+// invalidate evicts locally and tells the other instances to do the same.
+// Publishing is best effort: a lost message leaves peers serving stale
+// values for at most the L1 TTL.
+func (c *LayeredCache) invalidate(ctx context.Context, inv invalidationMessage) {
+	c.evict(inv)
+
+	inv.Origin = c.instanceID
+	payload, err := json.Marshal(inv)
+	if err != nil {
+		return
+	}
+	if err := c.l2.client.Publish(ctx, c.channel, payload).Err(); err != nil {
+		c.l2.recordError(opPublish, "")
+	}
+}
+
+func (c *LayeredCache) Get(ctx context.Context, key string, dest interface{}) error {
+	data, err := c.getBytes(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if err := c.l2.decode(data, dest); err != nil {
+		return fmt.Errorf("cache unmarshal error: %w", err)
+	}
+
+	return nil
+}
+
+func (c *LayeredCache) getBytes(ctx context.Context, key string) ([]byte, error) {
+	if data, ok := c.l1.get(key); ok {
+		c.l1Hits.Add(1)
+		c.l1Hit.Inc()
+		return data, nil
+	}
+	c.l1Misses.Add(1)
+
+	generation := c.fillGeneration()
+	data, remaining, err := c.l2.getBytesWithTTL(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	c.l2Hit.Inc()
+
+	c.fill(generation, key, data, c.fillTTL(remaining))
+	return data, nil
+}
+
+func (c *LayeredCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := c.l2.encode(value)
+	if err != nil {
+		return fmt.Errorf("cache marshal error: %w", err)
+	}
+
+	if err := c.l2.setBytes(ctx, key, data, ttl); err != nil {
+		return err
+	}
+
+	c.invalidate(ctx, invalidationMessage{Keys: []string{key}})
+	c.l1.set(key, data, c.l1TTL(ttl))
+	return nil
+}
+
+func (c *LayeredCache) SetWithTags(ctx context.Context, key string, value interface{}, ttl time.Duration, tags []string) error {
+	if err := c.l2.SetWithTags(ctx, key, value, ttl, tags); err != nil {
+		return err
+	}
+
+	c.invalidate(ctx, invalidationMessage{Keys: []string{key}})
+	return nil
+}
+
+func (c *LayeredCache) Delete(ctx context.Context, key string) error {
+	if err := c.l2.Delete(ctx, key); err != nil {
+		return err
+	}
+
+	c.invalidate(ctx, invalidationMessage{Keys: []string{key}})
+	return nil
+}
+
+// DeletePattern evicts matching keys from every L1 even when deleting from
+// L2 fails part way, since some L2 keys may already be gone.
+func (c *LayeredCache) DeletePattern(ctx context.Context, pattern string) (int64, error) {
+	deleted, err := c.l2.DeletePattern(ctx, pattern)
+	c.invalidate(ctx, invalidationMessage{Pattern: pattern})
+	return deleted, err
+}
+
+func (c *LayeredCache) Exists(ctx context.Context, key string) (bool, error) {
+	if _, ok := c.l1.get(key); ok {
+		return true, nil
+	}
+	return c.l2.Exists(ctx, key)
+}
+
+// GetMetrics combines both layers: hits from either layer count as hits and
+// only requests that missed L2 count as misses.
+func (c *LayeredCache) GetMetrics() CacheMetrics {
+	metrics := c.l2.GetMetrics()
+	metrics.Hits += c.l1Hits.Load()
+	metrics.TotalOps += c.l1Hits.Load()
+	if metrics.Hits+metrics.Misses > 0 {
+		metrics.HitRate = float64(metrics.Hits) / float64(metrics.Hits+metrics.Misses)
+	}
+	return metrics
+}
+
+// LayerMetrics reports L1 hits and misses separately from L2's own metrics.
+func (c *LayeredCache) LayerMetrics() (l1 CacheMetrics, l2 CacheMetrics) {
+	l1 = CacheMetrics{
+		Hits:     c.l1Hits.Load(),
+		Misses:   c.l1Misses.Load(),
+		TotalOps: c.l1Hits.Load() + c.l1Misses.Load(),
+	}
+	if l1.TotalOps > 0 {
+		l1.HitRate = float64(l1.Hits) / float64(l1.TotalOps)
+	}
+	return l1, c.l2.GetMetrics()
+}
+
+func (c *LayeredCache) Warm(ctx context.Context, keys []WarmupKey) error {
+	err := c.l2.Warm(ctx, keys)
+
+	invalidated := make([]string, 0, len(keys))
+	for _, warmupKey := range keys {
+		invalidated = append(invalidated, warmupKey.Key)
+	}
+	c.invalidate(ctx, invalidationMessage{Keys: invalidated})
+
+	return err
+}
+
+func (c *LayeredCache) InvalidateByTags(ctx context.Context, tags []string) error {
+	fullKeys, err := c.l2.invalidateTags(ctx, tags)
+	if len(fullKeys) > 0 {
+		keys := make([]string, 0, len(fullKeys))
+		for _, fullKey := range fullKeys {
+			keys = append(keys, c.l2.stripKey(fullKey))
+		}
+		c.invalidate(ctx, invalidationMessage{Keys: keys})
+	}
+	return err
+}
+
+func (c *LayeredCache) GetOrLoad(ctx context.Context, key string, dest interface{}, ttl time.Duration, loader LoaderFunc) error {
+	data, ok := c.l1.get(key)
+	if ok {
+		c.l1Hits.Add(1)
+		c.l1Hit.Inc()
+	} else {
+		c.l1Misses.Add(1)
+
+		generation := c.fillGeneration()
+		var remaining time.Duration
+		var err error
+		data, remaining, err = c.l2.getBytesWithTTL(ctx, key)
+		switch {
+		case err == nil:
+			c.l2Hit.Inc()
+			c.fill(generation, key, data, c.fillTTL(remaining))
+		case errors.Is(err, ErrKnownNotFound):
+			return err
+		default:
+			data, err = c.l2.loadMiss(ctx, key, ttl, loader, err)
+			if err != nil {
+				return err
+			}
+			c.fill(generation, key, data, c.l1TTL(ttl))
+		}
+	}
+
+	if err := c.l2.decode(data, dest); err != nil {
+		return fmt.Errorf("cache unmarshal error: %w", err)
+	}
+
+	return nil
+}
+
+// GetMany serves what it can from L1 and fetches the rest from L2 in one
+// batch.
+func (c *LayeredCache) GetMany(ctx context.Context, keys []string) (map[string]Value, []string, error) {
+	values := make(map[string]Value, len(keys))
+	var remote []string
+	for _, key := range keys {
+		if data, ok := c.l1.get(key); ok {
+			c.l1Hits.Add(1)
+			c.l1Hit.Inc()
+			values[key] = data
+			continue
+		}
+		c.l1Misses.Add(1)
+		remote = append(remote, key)
+	}
+
+	if len(remote) == 0 {
+		return values, nil, nil
+	}
+
+	generation := c.fillGeneration()
+	remaining := make([]time.Duration, len(remote))
+	found, missing, err := c.l2.getMany(ctx, remote, remaining)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, key := range remote {
+		data, ok := found[key]
+		if !ok {
+			continue
+		}
+		c.l2Hit.Inc()
+		c.fill(generation, key, data, c.fillTTL(remaining[i]))
+		values[key] = data
+	}
+
+	return values, missing, nil
+}
+
+func (c *LayeredCache) SetMany(ctx context.Context, items []Item) error {
+	err := c.l2.SetMany(ctx, items)
+
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, item.Key)
+	}
+	c.invalidate(ctx, invalidationMessage{Keys: keys})
+
+	return err
+}
+
+func (c *LayeredCache) DeleteMany(ctx context.Context, keys []string) (int64, error) {
+	deleted, err := c.l2.DeleteMany(ctx, keys)
+	c.invalidate(ctx, invalidationMessage{Keys: keys})
+	return deleted, err
+}
+
+// Close stops listening for invalidations. The underlying RedisCache is left
+// open.
+func (c *LayeredCache) Close() error {
+	var err error
+	c.once.Do(func() {
+		err = c.pubsub.Close()
+		<-c.done
+		c.l1.purge()
+	})
+	return err
+}
+
+// fillGeneration is taken before reading from L2, for fill.
+func (c *LayeredCache) fillGeneration() uint64 {
+	c.fillMu.Lock()
+	defer c.fillMu.Unlock()
+	return c.generation
+}
+
+// fill stores data read from L2 in L1, unless an invalidation ran since
+// generation was taken; the data may predate it. A ttl of zero or less means
+// the data already expired in L2 and is not stored.
+func (c *LayeredCache) fill(generation uint64, key string, data []byte, ttl time.Duration) {
+	c.fillMu.Lock()
+	defer c.fillMu.Unlock()
+
+	if c.generation == generation && ttl > 0 {
+		c.l1.set(key, data, ttl)
+	}
+}
+
+// fillTTL is the L1 TTL for a value read from L2 with remaining TTL left, as
+// PTTL reports it, so L1 never serves a value L2 has expired.
+func (c *LayeredCache) fillTTL(remaining time.Duration) time.Duration {
+	switch {
+	case remaining == -1:
+		return c.ttl
+	case remaining <= 0:
+		return 0
+	}
+	return c.l1TTL(remaining)
+}
+
+func (c *LayeredCache) l1TTL(ttl time.Duration) time.Duration {
+	if ttl > 0 && ttl < c.ttl {
+		return ttl
+	}
+	return c.ttl
+}
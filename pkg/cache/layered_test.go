@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestLayeredCache(t *testing.T, server *miniredis.Miniredis, config LayeredConfig) *LayeredCache {
+	t.Helper()
+	c, err := NewLayeredCache(connectTestCache(t, server, Config{KeyPrefix: "app"}), config, "test")
+	if err != nil {
+		t.Fatalf("NewLayeredCache: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestLayeredFillCappedAtL2TTL(t *testing.T) {
+	keys := []string{"short", "long", "forever"}
+	reads := map[string]func(ctx context.Context, c *LayeredCache) error{
+		"Get": func(ctx context.Context, c *LayeredCache) error {
+			for _, key := range keys {
+				var got string
+				if err := c.Get(ctx, key, &got); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		"GetMany": func(ctx context.Context, c *LayeredCache) error {
+			_, _, err := c.GetMany(ctx, keys)
+			return err
+		},
+		"GetOrLoad": func(ctx context.Context, c *LayeredCache) error {
+			loader := func(context.Context) (interface{}, error) {
+				t.Error("loader called for a key in L2")
+				return nil, nil
+			}
+			for _, key := range keys {
+				var got string
+				if err := c.GetOrLoad(ctx, key, &got, time.Hour, loader); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	for name, read := range reads {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			server := miniredis.RunT(t)
+			c := newTestLayeredCache(t, server, LayeredConfig{TTL: time.Minute})
+			clock := NewManualClock(time.Now())
+			c.l1.now = clock.Now
+
+			for key, ttl := range map[string]time.Duration{"short": 5 * time.Second, "long": 10 * time.Minute, "forever": 0} {
+				if err := c.l2.Set(ctx, key, key, ttl); err != nil {
+					t.Fatalf("Set %s: %v", key, err)
+				}
+			}
+			if err := read(ctx, c); err != nil {
+				t.Fatalf("read: %v", err)
+			}
+
+			cached := func(key string) bool {
+				_, ok := c.l1.get(key)
+				return ok
+			}
+			clock.Advance(6 * time.Second)
+			if cached("short") || !cached("long") || !cached("forever") {
+				t.Errorf("after 6s: short %v, long %v, forever %v; want only short dropped", cached("short"), cached("long"), cached("forever"))
+			}
+			clock.Advance(time.Minute)
+			if cached("long") || cached("forever") {
+				t.Error("L1 kept values past its own TTL")
+			}
+		})
+	}
+}
+
+func TestLayeredInvalidatesOtherInstances(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	a := newTestLayeredCache(t, server, LayeredConfig{TTL: time.Hour})
+	b := newTestLayeredCache(t, server, LayeredConfig{TTL: time.Hour})
+
+	// waitEvicted waits for the invalidation published by b to reach a.
+	waitEvicted := func(key string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if _, ok := a.l1.get(key); !ok {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s still in the other instance's L1", key)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	read := func(c *LayeredCache, key string) string {
+		t.Helper()
+		var got string
+		if err := c.Get(ctx, key, &got); err != nil {
+			t.Fatalf("Get %s: %v", key, err)
+		}
+		return got
+	}
+
+	for _, key := range []string{"user:1", "user:2", "order:1"} {
+		if err := b.Set(ctx, key, "v1", 0); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+		read(a, key)
+	}
+
+	if err := b.Set(ctx, "user:1", "v2", 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	waitEvicted("user:1")
+	if got := read(a, "user:1"); got != "v2" {
+		t.Errorf("Get after Set on the other instance = %q, want v2", got)
+	}
+
+	if err := b.Delete(ctx, "order:1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	waitEvicted("order:1")
+
+	if _, err := b.DeletePattern(ctx, "user:*"); err != nil {
+		t.Fatalf("DeletePattern: %v", err)
+	}
+	waitEvicted("user:1")
+	waitEvicted("user:2")
+
+	// b wrote every key itself, so its own L1 must not keep stale entries
+	// either.
+	if b.l1.len() != 0 {
+		t.Errorf("writer L1 holds %d entries, want 0", b.l1.len())
+	}
+}
@@ -0,0 +1,251 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var ErrNotRanked = fmt.Errorf("member not on leaderboard")
+
+type LeaderboardEntry struct {
+	Member string
+	Score  float64
+	// Rank is 1-based; rank 1 has the best score.
+	Rank int64
+}
+
+// Leaderboard is a sorted set keyed by CacheKeyBuilder.LeaderboardKey, so
+// score updates touch a single member instead of rewriting the whole list.
+// Periodic boards keep one sorted set per bucket, e.g.
+// "<prefix>:leaderboard:<category>:daily:2024-05-06".
+type Leaderboard struct {
+	cache     *RedisCache
+	key       string
+	period    Period
+	retention time.Duration
+	ascending bool
+	clock     Clock
+	at        time.Time
+}
+
+type LeaderboardOption func(*Leaderboard)
+
+// WithPeriod starts a new board every period. Defaults to PeriodAllTime.
+func WithPeriod(period Period) LeaderboardOption {
+	return func(l *Leaderboard) {
+		l.period = period
+	}
+}
+
+// WithRetention keeps a periodic board for this long after its period ends.
+// Defaults to one period, so the previous board stays readable.
+func WithRetention(retention time.Duration) LeaderboardOption {
+	return func(l *Leaderboard) {
+		l.retention = retention
+	}
+}
+
+// WithAscending ranks lower scores first, e.g. for completion times.
+func WithAscending() LeaderboardOption {
+	return func(l *Leaderboard) {
+		l.ascending = true
+	}
+}
+
+func WithLeaderboardClock(clock Clock) LeaderboardOption {
+	return func(l *Leaderboard) {
+		l.clock = clock
+	}
+}
+
+func NewLeaderboard(cache *RedisCache, category string, opts ...LeaderboardOption) (*Leaderboard, error) {
+	l := &Leaderboard{
+		cache: cache,
+		key:   cache.Keys().LeaderboardKey(category),
+		clock: systemClock{},
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	if !l.period.Valid() {
+		return nil, fmt.Errorf("invalid leaderboard period %q", l.period)
+	}
+	if l.retention <= 0 {
+		l.retention = l.period.length()
+	}
+	return l, nil
+}
+
+// At returns the board for the period containing t, e.g. yesterday's daily
+// board. It has no effect on PeriodAllTime boards.
+func (l *Leaderboard) At(t time.Time) *Leaderboard {
+	board := *l
+	board.at = t
+	return &board
+}
+
+// Add sets member's score, replacing any previous one.
+func (l *Leaderboard) Add(ctx context.Context, member string, score float64) error {
+	_, err := l.write(ctx, func(pipe redis.Pipeliner, key string) redis.Cmder {
+		return pipe.ZAdd(ctx, key, &redis.Z{Score: score, Member: member})
+	})
+	return err
+}
+
+// Increment adds delta to member's score and returns the new score.
+func (l *Leaderboard) Increment(ctx context.Context, member string, delta float64) (float64, error) {
+	cmd, err := l.write(ctx, func(pipe redis.Pipeliner, key string) redis.Cmder {
+		return pipe.ZIncrBy(ctx, key, delta, member)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return cmd.(*redis.FloatCmd).Val(), nil
+}
+
+func (l *Leaderboard) Remove(ctx context.Context, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	values := make([]interface{}, len(members))
+	for i, member := range members {
+		values[i] = member
+	}
+
+	_, err := l.write(ctx, func(pipe redis.Pipeliner, key string) redis.Cmder {
+		return pipe.ZRem(ctx, key, values...)
+	})
+	return err
+}
+
+// Rank returns member's entry, or ErrNotRanked if it has no score.
+func (l *Leaderboard) Rank(ctx context.Context, member string) (LeaderboardEntry, error) {
+	start := time.Now()
+	key := l.bucketKey()
+	fullKey := l.cache.buildKey(key)
+
+	var rankCmd *redis.IntCmd
+	var scoreCmd *redis.FloatCmd
+	_, err := l.cache.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		if l.ascending {
+			rankCmd = pipe.ZRank(ctx, fullKey, member)
+		} else {
+			rankCmd = pipe.ZRevRank(ctx, fullKey, member)
+		}
+		scoreCmd = pipe.ZScore(ctx, fullKey, member)
+		return nil
+	})
+	if errors.Is(err, redis.Nil) {
+		l.cache.record(opLeaderboard, key, start, resultMiss)
+		return LeaderboardEntry{}, ErrNotRanked
+	}
+	if err != nil {
+		l.cache.record(opLeaderboard, key, start, resultError)
+		return LeaderboardEntry{}, fmt.Errorf("leaderboard rank error: %w", err)
+	}
+
+	l.cache.record(opLeaderboard, key, start, resultHit)
+	return LeaderboardEntry{Member: member, Score: scoreCmd.Val(), Rank: rankCmd.Val() + 1}, nil
+}
+
+// Top returns the n best entries.
+func (l *Leaderboard) Top(ctx context.Context, n int64) ([]LeaderboardEntry, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	return l.rangeByRank(ctx, 0, n-1)
+}
+
+// Around returns member's entry with up to radius entries on either side,
+// e.g. for "you and your neighbours" views.
+func (l *Leaderboard) Around(ctx context.Context, member string, radius int64) ([]LeaderboardEntry, error) {
+	entry, err := l.Rank(ctx, member)
+	if err != nil {
+		return nil, err
+	}
+	index := entry.Rank - 1
+	return l.rangeByRank(ctx, max(index-radius, 0), index+radius)
+}
+
+// Count returns the number of members on the board.
+func (l *Leaderboard) Count(ctx context.Context) (int64, error) {
+	start := time.Now()
+	key := l.bucketKey()
+
+	count, err := l.cache.client.ZCard(ctx, l.cache.buildKey(key)).Result()
+	if err != nil {
+		l.cache.record(opLeaderboard, key, start, resultError)
+		return 0, fmt.Errorf("leaderboard count error: %w", err)
+	}
+	l.cache.record(opLeaderboard, key, start, resultOK)
+	return count, nil
+}
+
+func (l *Leaderboard) rangeByRank(ctx context.Context, from, to int64) ([]LeaderboardEntry, error) {
+	start := time.Now()
+	key := l.bucketKey()
+	fullKey := l.cache.buildKey(key)
+
+	var zs []redis.Z
+	var err error
+	if l.ascending {
+		zs, err = l.cache.client.ZRangeWithScores(ctx, fullKey, from, to).Result()
+	} else {
+		zs, err = l.cache.client.ZRevRangeWithScores(ctx, fullKey, from, to).Result()
+	}
+	if err != nil {
+		l.cache.record(opLeaderboard, key, start, resultError)
+		return nil, fmt.Errorf("leaderboard range error: %w", err)
+	}
+	l.cache.record(opLeaderboard, key, start, resultOK)
+
+	entries := make([]LeaderboardEntry, len(zs))
+	for i, z := range zs {
+		member, _ := z.Member.(string)
+		entries[i] = LeaderboardEntry{Member: member, Score: z.Score, Rank: from + int64(i) + 1}
+	}
+	return entries, nil
+}
+
+// write runs cmd against the current bucket and, for periodic boards, sets
+// the bucket's expiry in the same round trip.
+func (l *Leaderboard) write(ctx context.Context, cmd func(pipe redis.Pipeliner, key string) redis.Cmder) (redis.Cmder, error) {
+	start := time.Now()
+	key := l.bucketKey()
+	fullKey := l.cache.buildKey(key)
+
+	var result redis.Cmder
+	_, err := l.cache.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		result = cmd(pipe, fullKey)
+		if expireAt := l.period.expireAt(l.now(), l.retention); !expireAt.IsZero() {
+			pipe.ExpireAt(ctx, fullKey, expireAt)
+		}
+		return nil
+	})
+	if err != nil {
+		l.cache.record(opLeaderboard, key, start, resultError)
+		return nil, fmt.Errorf("leaderboard update error: %w", err)
+	}
+
+	l.cache.record(opLeaderboard, key, start, resultOK)
+	return result, nil
+}
+
+func (l *Leaderboard) bucketKey() string {
+	if l.period == PeriodAllTime {
+		return l.key
+	}
+	return fmt.Sprintf("%s:%s:%s", l.key, l.period, l.period.Bucket(l.now()))
+}
+
+func (l *Leaderboard) now() time.Time {
+	if !l.at.IsZero() {
+		return l.at
+	}
+	return l.clock.Now()
+}
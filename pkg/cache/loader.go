@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// LoaderFunc produces the value for a key on a cache miss.
+type LoaderFunc func(ctx context.Context) (interface{}, error)
+
+const (
+	loadLockPollInterval = 50 * time.Millisecond
+	loadLockPrefix       = internalKeyPrefix + "load_lock:"
+)
+
+var releaseLockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+
+// GetOrLoad reads key into dest and, on a miss, calls loader, caches its
+// result for ttl and decodes it into dest. Concurrent misses for the same key
+// in this process share a single loader call. When Config.LoadLockTTL is set,
+// a short Redis lock also keeps other instances from loading the same key at
+// once; they wait for the winner's value instead.
+//
+// With Config.NegativeTTL set, not-found loader errors are cached as
+// tombstones and later calls return a *NotFoundError without calling loader.
+//
+// Cache failures never fail the read: if Redis errors, the value is loaded
+// from the source and the write-back is best effort.
+//
+// The shared load runs detached from ctx, bounded by Config.LoadTimeout, so a
+// caller whose ctx ends returns ctx.Err() without failing the others.
+func (c *RedisCache) GetOrLoad(ctx context.Context, key string, dest interface{}, ttl time.Duration, loader LoaderFunc) error {
+	data, err := c.getOrLoadBytes(ctx, key, ttl, loader)
+	if err != nil {
+		return err
+	}
+
+	if err := c.decode(data, dest); err != nil {
+		return fmt.Errorf("cache unmarshal error: %w", err)
+	}
+
+	return nil
+}
+
+func (c *RedisCache) getOrLoadBytes(ctx context.Context, key string, ttl time.Duration, loader LoaderFunc) ([]byte, error) {
+	data, err := c.getBytes(ctx, key)
+	if err == nil || errors.Is(err, ErrKnownNotFound) {
+		return data, err
+	}
+	return c.loadMiss(ctx, key, ttl, loader, err)
+}
+
+// loadMiss loads key after reading it from Redis failed with readErr.
+func (c *RedisCache) loadMiss(ctx context.Context, key string, ttl time.Duration, loader LoaderFunc, readErr error) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	reportRecovered(ctx, readErr)
+
+	return c.loads.Do(ctx, key, func() ([]byte, error) {
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.loadTimeout)
+		defer cancel()
+		return c.load(loadCtx, key, ttl, loader)
+	})
+}
+
+func (c *RedisCache) load(ctx context.Context, key string, ttl time.Duration, loader LoaderFunc) ([]byte, error) {
+	if c.loadLockTTL > 0 {
+		lockKey := c.buildKey(loadLockPrefix + key)
+		token, acquired, err := c.acquireLock(ctx, lockKey, c.loadLockTTL)
+		switch {
+		case err != nil:
+			c.recordError(opLoad, key)
+			reportRecovered(ctx, err)
+		case acquired:
+			defer func() {
+				_, _ = releaseLock(context.Background(), c.client, lockKey, token)
+			}()
+		default:
+			if data, ok := c.waitForValue(ctx, key, c.loadLockTTL); ok {
+				if isTombstone(data) {
+					return nil, c.notFoundError(ctx, key)
+				}
+				return data, nil
+			}
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	value, err := loader(ctx)
+	if err != nil {
+		if c.negativeTTL > 0 && isNotFound(err) {
+			if setErr := c.SetNotFound(ctx, key, c.negativeTTL); setErr != nil {
+				c.recordError(opLoad, key)
+				reportRecovered(ctx, setErr)
+			}
+		}
+		return nil, err
+	}
+
+	data, err := c.encode(value)
+	if err != nil {
+		return nil, fmt.Errorf("cache marshal error: %w", err)
+	}
+
+	start := time.Now()
+	if err := c.client.Set(ctx, c.buildKey(key), data, ttl).Err(); err != nil {
+		c.record(opLoad, key, start, resultError)
+		reportRecovered(ctx, err)
+	} else {
+		c.record(opLoad, key, start, resultOK)
+	}
+
+	return data, nil
+}
+
+// waitForValue polls for a value being loaded by another instance until it
+// appears or the other instance's lock would have expired.
+func (c *RedisCache) waitForValue(ctx context.Context, key string, timeout time.Duration) ([]byte, bool) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	ticker := time.NewTicker(loadLockPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-deadline.C:
+			return nil, false
+		case <-ticker.C:
+			data, err := c.client.Get(ctx, c.buildKey(key)).Bytes()
+			if err == nil {
+				return data, true
+			}
+			if !errors.Is(err, redis.Nil) {
+				reportRecovered(ctx, err)
+				return nil, false
+			}
+		}
+	}
+}
+
+func newLockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate lock token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
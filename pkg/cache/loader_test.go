@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// blockingLoader returns a loader that signals started, then waits for
+// release before returning value. It counts its calls in loads.
+func blockingLoader(value string, loads *atomic.Int32, started chan<- struct{}, release <-chan struct{}) LoaderFunc {
+	return func(ctx context.Context) (interface{}, error) {
+		loads.Add(1)
+		if started != nil {
+			started <- struct{}{}
+		}
+		<-release
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+}
+
+func TestGetOrLoadSharesConcurrentMisses(t *testing.T) {
+	c, _ := newTestRedisCache(t, "app")
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	loader := blockingLoader("loaded", &loads, nil, release)
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make([]string, callers)
+	errs := make([]error, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.GetOrLoad(context.Background(), "key", &results[i], time.Minute, loader)
+		}()
+	}
+	// Give every caller time to miss and join the shared load.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i := range callers {
+		if errs[i] != nil || results[i] != "loaded" {
+			t.Errorf("caller %d = %q, %v; want loaded", i, results[i], errs[i])
+		}
+	}
+	if got := loads.Load(); got != 1 {
+		t.Errorf("loader called %d times, want 1", got)
+	}
+}
+
+func TestGetOrLoadWaitsForOtherInstance(t *testing.T) {
+	tests := []struct {
+		name string
+		// stall keeps the winner from ever writing a value.
+		stall    bool
+		want     string
+		wantLoad int32
+	}{
+		{"gets the winner's value", false, "winner", 0},
+		{"loads itself after the lock TTL", true, "loser", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := miniredis.RunT(t)
+			config := Config{KeyPrefix: "app", LoadLockTTL: 500 * time.Millisecond}
+			winner := connectTestCache(t, server, config)
+			loser := connectTestCache(t, server, config)
+
+			var winnerLoads, loserLoads atomic.Int32
+			started := make(chan struct{}, 1)
+			release := make(chan struct{})
+			winnerDone := make(chan struct{})
+			go func() {
+				defer close(winnerDone)
+				var got string
+				_ = winner.GetOrLoad(context.Background(), "key", &got, time.Minute, blockingLoader("winner", &winnerLoads, started, release))
+			}()
+			<-started
+
+			if !tt.stall {
+				go func() {
+					time.Sleep(150 * time.Millisecond)
+					close(release)
+				}()
+			} else {
+				defer close(release)
+			}
+
+			var got string
+			err := loser.GetOrLoad(context.Background(), "key", &got, time.Minute, func(context.Context) (interface{}, error) {
+				loserLoads.Add(1)
+				return "loser", nil
+			})
+			if err != nil || got != tt.want {
+				t.Fatalf("GetOrLoad = %q, %v; want %q", got, err, tt.want)
+			}
+			if n := loserLoads.Load(); n != tt.wantLoad {
+				t.Errorf("second instance loaded %d times, want %d", n, tt.wantLoad)
+			}
+			if !tt.stall {
+				<-winnerDone
+				if n := winnerLoads.Load(); n != 1 {
+					t.Errorf("winner loaded %d times, want 1", n)
+				}
+			}
+		})
+	}
+}
+
+func TestGetOrLoadCallerCancel(t *testing.T) {
+	c, _ := newTestRedisCache(t, "app")
+
+	var loads atomic.Int32
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	loader := blockingLoader("loaded", &loads, started, release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		var got string
+		firstErr <- c.GetOrLoad(ctx, "key", &got, time.Minute, loader)
+	}()
+	<-started
+
+	var got string
+	secondErr := make(chan error, 1)
+	go func() {
+		secondErr <- c.GetOrLoad(context.Background(), "key", &got, time.Minute, loader)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled caller = %v, want context.Canceled", err)
+	}
+	close(release)
+
+	if err := <-secondErr; err != nil || got != "loaded" {
+		t.Fatalf("other caller = %q, %v; want loaded", got, err)
+	}
+	if n := loads.Load(); n != 1 {
+		t.Errorf("loader called %d times, want 1", n)
+	}
+}
+
+func TestGetOrLoadLoaderPanic(t *testing.T) {
+	redisCache, _ := newTestRedisCache(t, "app")
+
+	tests := []struct {
+		name  string
+		cache Cache
+	}{
+		{"redis", redisCache},
+		{"memory", NewMemoryCache()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cause := errors.New("boom")
+			recovered := func() (r interface{}) {
+				defer func() { r = recover() }()
+				var got string
+				_ = tt.cache.GetOrLoad(context.Background(), "key", &got, time.Minute, func(context.Context) (interface{}, error) {
+					panic(cause)
+				})
+				return nil
+			}()
+
+			err, ok := recovered.(error)
+			if !ok || !errors.Is(err, cause) {
+				t.Fatalf("caller recovered %v, want a panic wrapping %v", recovered, cause)
+			}
+
+			var got string
+			err = tt.cache.GetOrLoad(context.Background(), "key", &got, time.Minute, func(context.Context) (interface{}, error) {
+				return "loaded", nil
+			})
+			if err != nil || got != "loaded" {
+				t.Fatalf("GetOrLoad after panic = %q, %v; want loaded", got, err)
+			}
+		})
+	}
+}
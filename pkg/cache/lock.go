@@ -0,0 +1,273 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	apperrors "github.com/Zorynix/shared/pkg/errors"
+)
+
+const (
+	lockKeyPrefix       = "lock:"
+	defaultLockTTL      = 30 * time.Second
+	defaultLockRetryMin = 10 * time.Millisecond
+	defaultLockRetryMax = 500 * time.Millisecond
+)
+
+var extendLockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+var ErrLockNotHeld = fmt.Errorf("lock not held")
+
+type LockOptions struct {
+	// TTL is how long the lock is held unless released or extended.
+	// Defaults to 30s.
+	TTL time.Duration
+	// WaitTimeout is how long Lock retries while the lock is held
+	// elsewhere. Zero tries once. The context deadline also applies.
+	WaitTimeout time.Duration
+	// RetryMin and RetryMax bound the jittered exponential backoff between
+	// attempts. They default to 10ms and 500ms.
+	RetryMin time.Duration
+	RetryMax time.Duration
+	// KeepAlive extends the lock every TTL/3 until it is released, so work
+	// of unknown length does not outlive the lock.
+	KeepAlive bool
+}
+
+// Lock is a distributed lock held by this process. Only the holder of the
+// token can extend or release it.
+type Lock struct {
+	client  redis.UniversalClient
+	key     string
+	fullKey string
+	token   string
+	ttl     time.Duration
+
+	mu       sync.Mutex
+	released bool
+	stop     chan struct{}
+	done     chan struct{}
+	lost     chan struct{}
+}
+
+// Lock acquires the named lock, waiting with backoff for up to
+// opts.WaitTimeout while another holder has it. If the lock cannot be
+// acquired it returns an AppError with code ErrResourceLocked.
+func (c *RedisCache) Lock(ctx context.Context, name string, opts LockOptions) (*Lock, error) {
+	if opts.TTL <= 0 {
+		opts.TTL = defaultLockTTL
+	}
+	if opts.RetryMin <= 0 {
+		opts.RetryMin = defaultLockRetryMin
+	}
+	if opts.RetryMax < opts.RetryMin {
+		opts.RetryMax = max(defaultLockRetryMax, opts.RetryMin)
+	}
+
+	key := lockKeyPrefix + name
+	fullKey := c.buildKey(internalKeyPrefix + key)
+
+	var deadline <-chan time.Time
+	if opts.WaitTimeout > 0 {
+		timer := time.NewTimer(opts.WaitTimeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	backoff := opts.RetryMin
+	for {
+		start := time.Now()
+		token, acquired, err := c.acquireLock(ctx, fullKey, opts.TTL)
+		if err != nil {
+			c.record(opLock, key, start, resultError)
+			return nil, fmt.Errorf("cache lock error: %w", err)
+		}
+		if acquired {
+			c.record(opLock, key, start, resultOK)
+			lock := &Lock{
+				client:  c.client,
+				key:     name,
+				fullKey: fullKey,
+				token:   token,
+				ttl:     opts.TTL,
+				lost:    make(chan struct{}),
+			}
+			if opts.KeepAlive {
+				lock.keepAlive()
+			}
+			return lock, nil
+		}
+		c.record(opLock, key, start, resultMiss)
+
+		if deadline == nil {
+			return nil, lockedError(name, nil)
+		}
+
+		wait := backoff/2 + rand.N(backoff/2+1)
+		backoff = min(backoff*2, opts.RetryMax)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, lockedError(name, ctx.Err())
+		case <-deadline:
+			timer.Stop()
+			return nil, lockedError(name, nil)
+		case <-timer.C:
+		}
+	}
+}
+
+// TryLock makes a single attempt to acquire the named lock for ttl.
+func (c *RedisCache) TryLock(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	return c.Lock(ctx, name, LockOptions{TTL: ttl})
+}
+
+// WithLock runs fn while holding the named lock with keepalive, releasing it
+// afterwards. ctx passed to fn is cancelled if the lock is lost.
+func (c *RedisCache) WithLock(ctx context.Context, name string, opts LockOptions, fn func(ctx context.Context) error) error {
+	opts.KeepAlive = true
+	lock, err := c.Lock(ctx, name, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = lock.Release(context.Background())
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-lock.Lost():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return fn(ctx)
+}
+
+func lockedError(name string, cause error) error {
+	err := apperrors.NewAppErrorWithDetails(apperrors.ErrResourceLocked, "Resource is locked", name)
+	if cause != nil {
+		err = err.WithCause(cause)
+	}
+	return err
+}
+
+// acquireLock sets fullKey to a fresh token if it is not already set.
+func (c *RedisCache) acquireLock(ctx context.Context, fullKey string, ttl time.Duration) (string, bool, error) {
+	token, err := newLockToken()
+	if err != nil {
+		return "", false, err
+	}
+	acquired, err := c.client.SetNX(ctx, fullKey, token, ttl).Result()
+	if err != nil {
+		return "", false, err
+	}
+	return token, acquired, nil
+}
+
+func releaseLock(ctx context.Context, client redis.UniversalClient, fullKey, token string) (bool, error) {
+	released, err := releaseLockScript.Run(ctx, client, []string{fullKey}, token).Int64()
+	if err != nil {
+		return false, err
+	}
+	return released == 1, nil
+}
+
+func (l *Lock) Key() string {
+	return l.key
+}
+
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// Lost is closed when a keepalive finds the lock no longer held, e.g.
+// because it expired while Redis was unreachable.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Extend resets the lock's TTL. It returns ErrLockNotHeld if the lock has
+// expired or was taken over.
+func (l *Lock) Extend(ctx context.Context, ttl time.Duration) error {
+	extended, err := extendLockScript.Run(ctx, l.client, []string{l.fullKey}, l.token, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return fmt.Errorf("cache lock extend error: %w", err)
+	}
+	if extended == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Release stops the keepalive and deletes the lock if it is still held by
+// this token. Releasing twice is a no-op.
+func (l *Lock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	if l.released {
+		l.mu.Unlock()
+		return nil
+	}
+	l.released = true
+	stop, done := l.stop, l.done
+	l.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
+	released, err := releaseLock(ctx, l.client, l.fullKey, l.token)
+	if err != nil {
+		return fmt.Errorf("cache lock release error: %w", err)
+	}
+	if !released {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+func (l *Lock) keepAlive() {
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+
+	go func() {
+		defer close(l.done)
+
+		ticker := time.NewTicker(l.ttl / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-l.stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+				err := l.Extend(ctx, l.ttl)
+				cancel()
+				// Transient errors are retried on the next tick while the
+				// lock may still be alive.
+				if errors.Is(err, ErrLockNotHeld) {
+					close(l.lost)
+					return
+				}
+			}
+		}
+	}()
+}
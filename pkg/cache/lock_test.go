@@ -0,0 +1,209 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apperrors "github.com/Zorynix/shared/pkg/errors"
+)
+
+func isLocked(err error) bool {
+	var appErr *apperrors.AppError
+	return errors.As(err, &appErr) && appErr.Code == apperrors.ErrResourceLocked
+}
+
+func TestLockAcquireRelease(t *testing.T) {
+	ctx := context.Background()
+	c, server := newTestRedisCache(t, "app")
+
+	lock, err := c.TryLock(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatalf("TryLock: %v", err)
+	}
+	if !server.Exists("app:" + internalKeyPrefix + "lock:job") {
+		t.Fatalf("lock key missing, keys = %v", server.Keys())
+	}
+	if lock.Key() != "job" || lock.Token() == "" {
+		t.Fatalf("Key = %q, Token = %q", lock.Key(), lock.Token())
+	}
+
+	if _, err := c.TryLock(ctx, "job", time.Minute); !isLocked(err) {
+		t.Fatalf("second TryLock = %v, want ErrResourceLocked", err)
+	}
+	if _, err := c.TryLock(ctx, "other", time.Minute); err != nil {
+		t.Fatalf("TryLock on another name: %v", err)
+	}
+
+	if err := lock.Release(ctx); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if err := lock.Release(ctx); err != nil {
+		t.Fatalf("second Release = %v, want a no-op", err)
+	}
+	if _, err := c.TryLock(ctx, "job", time.Minute); err != nil {
+		t.Fatalf("TryLock after release: %v", err)
+	}
+}
+
+func TestLockExpiry(t *testing.T) {
+	ctx := context.Background()
+	c, server := newTestRedisCache(t, "app")
+
+	lock, err := c.TryLock(ctx, "job", 10*time.Second)
+	if err != nil {
+		t.Fatalf("TryLock: %v", err)
+	}
+
+	if err := lock.Extend(ctx, 30*time.Second); err != nil {
+		t.Fatalf("Extend: %v", err)
+	}
+	server.FastForward(20 * time.Second)
+	if _, err := c.TryLock(ctx, "job", time.Minute); !isLocked(err) {
+		t.Fatalf("TryLock within extended TTL = %v, want ErrResourceLocked", err)
+	}
+
+	server.FastForward(11 * time.Second)
+	other, err := c.TryLock(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatalf("TryLock after expiry: %v", err)
+	}
+
+	// The expired holder must not touch the new holder's lock.
+	if err := lock.Extend(ctx, time.Minute); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("Extend after expiry = %v, want ErrLockNotHeld", err)
+	}
+	if err := lock.Release(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("Release after expiry = %v, want ErrLockNotHeld", err)
+	}
+	if err := other.Release(ctx); err != nil {
+		t.Errorf("new holder Release: %v", err)
+	}
+}
+
+func TestLockWait(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestRedisCache(t, "app")
+
+	held, err := c.TryLock(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatalf("TryLock: %v", err)
+	}
+
+	if _, err := c.Lock(ctx, "job", LockOptions{WaitTimeout: 50 * time.Millisecond}); !isLocked(err) {
+		t.Fatalf("Lock past WaitTimeout = %v, want ErrResourceLocked", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := c.Lock(cancelled, "job", LockOptions{WaitTimeout: 5 * time.Second}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Lock with cancelled ctx = %v, want context.Canceled", err)
+	}
+
+	time.AfterFunc(50*time.Millisecond, func() { _ = held.Release(ctx) })
+	lock, err := c.Lock(ctx, "job", LockOptions{WaitTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("Lock waiting for release: %v", err)
+	}
+	_ = lock.Release(ctx)
+}
+
+func TestLockKeepAlive(t *testing.T) {
+	ctx := context.Background()
+	c, server := newTestRedisCache(t, "app")
+	lockKey := "app:" + internalKeyPrefix + "lock:job"
+
+	const ttl = 300 * time.Millisecond
+	lock, err := c.Lock(ctx, "job", LockOptions{TTL: ttl, KeepAlive: true})
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+
+	// miniredis only expires keys on FastForward, so move its clock past
+	// the original TTL in steps and let a keepalive tick run in between.
+	for range 3 {
+		server.FastForward(ttl * 2 / 3)
+		time.Sleep(ttl / 2)
+	}
+	if !server.Exists(lockKey) {
+		t.Fatal("lock expired despite keepalive")
+	}
+	select {
+	case <-lock.Lost():
+		t.Fatal("Lost closed while the lock is held")
+	default:
+	}
+
+	// Another holder takes over, e.g. after the lock expired during a
+	// network partition.
+	server.Set(lockKey, "other-token")
+	select {
+	case <-lock.Lost():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Lost not closed after the lock was taken over")
+	}
+
+	if err := lock.Release(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("Release after loss = %v, want ErrLockNotHeld", err)
+	}
+	if got, _ := server.Get(lockKey); got != "other-token" {
+		t.Errorf("lost lock's Release changed the new holder's token to %q", got)
+	}
+}
+
+func TestWithLockCancelsOnLoss(t *testing.T) {
+	ctx := context.Background()
+	c, server := newTestRedisCache(t, "app")
+
+	err := c.WithLock(ctx, "job", LockOptions{TTL: 300 * time.Millisecond}, func(ctx context.Context) error {
+		server.Del("app:" + internalKeyPrefix + "lock:job")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+			return errors.New("ctx not cancelled after the lock was lost")
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("WithLock = %v, want context.Canceled", err)
+	}
+}
+
+func TestDeletePatternSkipsInternalKeys(t *testing.T) {
+	ctx := context.Background()
+	c, server := newTestRedisCache(t, "app")
+
+	lock, err := c.TryLock(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatalf("TryLock: %v", err)
+	}
+	if err := c.SetWithTags(ctx, "tagged", 1, time.Minute, []string{"t"}); err != nil {
+		t.Fatalf("SetWithTags: %v", err)
+	}
+	// User keys that look like internal ones are ordinary keys.
+	for _, key := range []string{"plain", "lock:user", "__tags:user"} {
+		if err := c.Set(ctx, key, 1, time.Minute); err != nil {
+			t.Fatalf("Set %s: %v", key, err)
+		}
+	}
+
+	deleted, err := c.DeletePattern(ctx, "*")
+	if err != nil || deleted != 4 {
+		t.Fatalf("DeletePattern = %d, %v; want 4, keys left = %v", deleted, err, server.Keys())
+	}
+	if err := lock.Release(ctx); err != nil {
+		t.Fatalf("Release after DeletePattern: %v", err)
+	}
+
+	for key, want := range map[string]bool{
+		internalKeyPrefix + "lock:job": true,
+		"lock:user":                    false,
+		"__tags:user":                  false,
+		"plain":                        false,
+	} {
+		if got := isInternalKey(key); got != want {
+			t.Errorf("isInternalKey(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
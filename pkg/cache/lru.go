@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lruSweepInterval is how often set removes every expired entry, so an
+// unbounded store does not keep expired keys that are never read again.
+const lruSweepInterval = time.Minute
+
+// lru is a bounded, TTL-aware store of encoded values with a tag index. A
+// maxEntries of zero means unbounded.
+type lru struct {
+	mu         sync.Mutex
+	maxEntries int
+	ll         *list.List
+	items      map[string]*list.Element
+	tags       map[string]map[string]struct{}
+	now        func() time.Time
+	lastSweep  time.Time
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+	tags      []string
+}
+
+func newLRU(maxEntries int, now func() time.Time) *lru {
+	return &lru{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		tags:       make(map[string]map[string]struct{}),
+		now:        now,
+		lastSweep:  now(),
+	}
+}
+
+func (l *lru) get(key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	elem, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*lruEntry)
+	if l.expired(entry) {
+		l.removeElement(elem)
+		return nil, false
+	}
+
+	l.ll.MoveToFront(elem)
+	return entry.value, true
+}
+
+// set stores value for ttl; a ttl of zero or less never expires.
+func (l *lru) set(key string, value []byte, ttl time.Duration) {
+	l.setWithTags(key, value, ttl, nil)
+}
+
+// setWithTags is set that also adds key to tags. Like the Redis tag index,
+// tags from earlier writes are kept until the key is removed.
+func (l *lru) setWithTags(key string, value []byte, ttl time.Duration, tags []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= lruSweepInterval {
+		l.sweep()
+		l.lastSweep = now
+	}
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = now.Add(ttl)
+	}
+
+	elem, ok := l.items[key]
+	if ok {
+		entry := elem.Value.(*lruEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		l.ll.MoveToFront(elem)
+	} else {
+		elem = l.ll.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+		l.items[key] = elem
+	}
+	l.tag(elem.Value.(*lruEntry), tags)
+
+	if l.maxEntries > 0 && l.ll.Len() > l.maxEntries {
+		l.removeElement(l.ll.Back())
+	}
+}
+
+// invalidateTags removes every key carrying one of tags.
+func (l *lru) invalidateTags(tags []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, tag := range tags {
+		for key := range l.tags[tag] {
+			if elem, ok := l.items[key]; ok {
+				l.removeElement(elem)
+			}
+		}
+		delete(l.tags, tag)
+	}
+}
+
+func (l *lru) delete(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	elem, ok := l.items[key]
+	if !ok {
+		return false
+	}
+	expired := l.expired(elem.Value.(*lruEntry))
+	l.removeElement(elem)
+	return !expired
+}
+
+// deleteMatching removes live keys matching a Redis-style glob pattern and
+// returns how many it removed.
+func (l *lru) deleteMatching(pattern string) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var deleted int64
+	for key, elem := range l.items {
+		if !matchGlob(pattern, key) {
+			continue
+		}
+		if !l.expired(elem.Value.(*lruEntry)) {
+			deleted++
+		}
+		l.removeElement(elem)
+	}
+	return deleted
+}
+
+func (l *lru) purge() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.ll.Init()
+	l.items = make(map[string]*list.Element)
+	l.tags = make(map[string]map[string]struct{})
+}
+
+func (l *lru) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.ll.Len()
+}
+
+func (l *lru) expired(entry *lruEntry) bool {
+	return !entry.expiresAt.IsZero() && !l.now().Before(entry.expiresAt)
+}
+
+// tag must be called with mu held.
+func (l *lru) tag(entry *lruEntry, tags []string) {
+	for _, tag := range tags {
+		keys, ok := l.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			l.tags[tag] = keys
+		}
+		if _, ok := keys[entry.key]; !ok {
+			keys[entry.key] = struct{}{}
+			entry.tags = append(entry.tags, tag)
+		}
+	}
+}
+
+// sweep removes every expired entry. It must be called with mu held.
+func (l *lru) sweep() {
+	for _, elem := range l.items {
+		if l.expired(elem.Value.(*lruEntry)) {
+			l.removeElement(elem)
+		}
+	}
+}
+
+// removeElement is the only way entries leave the store, so it also drops
+// the key from its tags. It must be called with mu held.
+func (l *lru) removeElement(elem *list.Element) {
+	entry := elem.Value.(*lruEntry)
+	l.ll.Remove(elem)
+	delete(l.items, entry.key)
+
+	for _, tag := range entry.tags {
+		keys := l.tags[tag]
+		delete(keys, entry.key)
+		if len(keys) == 0 {
+			delete(l.tags, tag)
+		}
+	}
+}
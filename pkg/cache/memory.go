@@ -0,0 +1,231 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// MemoryCache is an in-process implementation of Cache for unit tests and
+// single-node deployments. As with RedisCache, patterns use Redis glob
+// syntax and a zero TTL never expires. Unlike it, values are always stored
+// JSON-encoded, whatever codec a RedisCache would use, and there are no
+// tombstones: GetOrLoad calls the loader again after a not-found error, as
+// if NegativeTTL were unset.
+type MemoryCache struct {
+	store *lru
+	loads flightGroup
+	stats *metricsRecorder
+}
+
+type MemoryOption func(*memoryOptions)
+
+type memoryOptions struct {
+	clock      Clock
+	maxEntries int
+}
+
+// WithClock makes expiry follow clock instead of the wall clock. Latencies
+// in metrics always use the wall clock.
+func WithClock(clock Clock) MemoryOption {
+	return func(o *memoryOptions) {
+		o.clock = clock
+	}
+}
+
+// WithMaxEntries bounds the cache, evicting least recently used keys first.
+func WithMaxEntries(maxEntries int) MemoryOption {
+	return func(o *memoryOptions) {
+		o.maxEntries = maxEntries
+	}
+}
+
+func NewMemoryCache(opts ...MemoryOption) *MemoryCache {
+	options := memoryOptions{clock: systemClock{}}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return &MemoryCache{
+		store: newLRU(options.maxEntries, options.clock.Now),
+		stats: newMetricsRecorder(options.clock.Now),
+	}
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string, dest interface{}) error {
+	start := time.Now()
+
+	data, ok := c.store.get(key)
+	if !ok {
+		c.record(opGet, key, start, resultMiss)
+		return ErrCacheKeyNotFound
+	}
+	c.record(opGet, key, start, resultHit)
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		c.stats.recordError(opGet, key)
+		return fmt.Errorf("cache unmarshal error: %w", err)
+	}
+
+	return nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return c.SetWithTags(ctx, key, value, ttl, nil)
+}
+
+func (c *MemoryCache) SetWithTags(ctx context.Context, key string, value interface{}, ttl time.Duration, tags []string) error {
+	start := time.Now()
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		c.record(opSet, key, start, resultError)
+		return fmt.Errorf("cache marshal error: %w", err)
+	}
+
+	c.store.setWithTags(key, data, ttl, tags)
+	c.record(opSet, key, start, resultOK)
+	return nil
+}
+
+func (c *MemoryCache) Delete(ctx context.Context, key string) error {
+	start := time.Now()
+
+	c.store.delete(key)
+	c.record(opDelete, key, start, resultOK)
+	return nil
+}
+
+func (c *MemoryCache) DeletePattern(ctx context.Context, pattern string) (int64, error) {
+	start := time.Now()
+
+	deleted := c.store.deleteMatching(pattern)
+	c.record(opDeletePattern, pattern, start, resultOK)
+	return deleted, nil
+}
+
+func (c *MemoryCache) Exists(ctx context.Context, key string) (bool, error) {
+	start := time.Now()
+
+	_, ok := c.store.get(key)
+	c.record(opExists, key, start, resultOK)
+	return ok, nil
+}
+
+func (c *MemoryCache) GetMetrics() CacheMetrics {
+	return c.stats.snapshot()
+}
+
+func (c *MemoryCache) WindowMetrics() CacheMetrics {
+	return c.stats.windowSnapshot()
+}
+
+func (c *MemoryCache) ResetMetrics() CacheMetrics {
+	return c.stats.resetWindow()
+}
+
+// Warm writes every key, continuing past failures like RedisCache.Warm.
+func (c *MemoryCache) Warm(ctx context.Context, keys []WarmupKey) error {
+	start := time.Now()
+	report := &WarmReport{Total: len(keys)}
+	for _, warmupKey := range keys {
+		if err := c.SetWithTags(ctx, warmupKey.Key, warmupKey.Value, warmupKey.TTL, warmupKey.Tags); err != nil {
+			report.Failed = append(report.Failed, WarmFailure{Key: warmupKey.Key, Err: err})
+		}
+	}
+	report.Succeeded = report.Total - len(report.Failed)
+	report.Duration = time.Since(start)
+	return report.Err()
+}
+
+func (c *MemoryCache) InvalidateByTags(ctx context.Context, tags []string) error {
+	c.store.invalidateTags(tags)
+	return nil
+}
+
+func (c *MemoryCache) GetOrLoad(ctx context.Context, key string, dest interface{}, ttl time.Duration, loader LoaderFunc) error {
+	if err := c.Get(ctx, key, dest); err == nil {
+		return nil
+	}
+
+	data, err := c.loads.Do(ctx, key, func() ([]byte, error) {
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), defaultLoadTimeout)
+		defer cancel()
+
+		value, err := loader(loadCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("cache marshal error: %w", err)
+		}
+
+		c.store.set(key, data, ttl)
+		return data, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		return fmt.Errorf("cache unmarshal error: %w", err)
+	}
+
+	return nil
+}
+
+func (c *MemoryCache) GetMany(ctx context.Context, keys []string) (map[string]Value, []string, error) {
+	values := make(map[string]Value, len(keys))
+	var missing []string
+	for _, key := range keys {
+		start := time.Now()
+		data, ok := c.store.get(key)
+		if !ok {
+			c.record(opGetMany, key, start, resultMiss)
+			missing = append(missing, key)
+			continue
+		}
+		c.record(opGetMany, key, start, resultHit)
+		values[key] = data
+	}
+	return values, missing, nil
+}
+
+func (c *MemoryCache) SetMany(ctx context.Context, items []Item) error {
+	for _, item := range items {
+		if err := c.Set(ctx, item.Key, item.Value, item.TTL); err != nil {
+			return fmt.Errorf("key %s: %w", item.Key, err)
+		}
+	}
+	return nil
+}
+
+func (c *MemoryCache) DeleteMany(ctx context.Context, keys []string) (int64, error) {
+	var deleted int64
+	for _, key := range keys {
+		start := time.Now()
+		if c.store.delete(key) {
+			deleted++
+		}
+		c.record(opDeleteMany, key, start, resultOK)
+	}
+	return deleted, nil
+}
+
+// Len returns the number of stored entries, including expired ones that
+// have not been evicted yet.
+func (c *MemoryCache) Len() int {
+	return c.store.len()
+}
+
+// Flush removes every entry and tag.
+func (c *MemoryCache) Flush() {
+	c.store.purge()
+}
+
+func (c *MemoryCache) record(op, key string, start time.Time, result opResult) {
+	c.stats.record(op, key, result, time.Since(start))
+}
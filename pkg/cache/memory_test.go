@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheExpiry(t *testing.T) {
+	ctx := context.Background()
+	clock := NewManualClock(time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC))
+	c := NewMemoryCache(WithClock(clock))
+
+	if err := c.Set(ctx, "short", 1, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := c.Set(ctx, "forever", 2, 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	tests := []struct {
+		advance     time.Duration
+		wantShort   bool
+		wantForever bool
+	}{
+		{0, true, true},
+		{time.Minute - time.Nanosecond, true, true},
+		{time.Nanosecond, false, true},
+		{365 * 24 * time.Hour, false, true},
+	}
+
+	for i, tt := range tests {
+		clock.Advance(tt.advance)
+		for key, want := range map[string]bool{"short": tt.wantShort, "forever": tt.wantForever} {
+			var got int
+			switch err := c.Get(ctx, key, &got); {
+			case want && err != nil:
+				t.Errorf("step %d: Get(%s) = %v, want a hit", i, key, err)
+			case !want && !errors.Is(err, ErrCacheKeyNotFound):
+				t.Errorf("step %d: Get(%s) = %v, want ErrCacheKeyNotFound", i, key, err)
+			}
+			if exists, _ := c.Exists(ctx, key); exists != want {
+				t.Errorf("step %d: Exists(%s) = %v, want %v", i, key, exists, want)
+			}
+		}
+	}
+}
+
+func TestMemoryCacheDeletePattern(t *testing.T) {
+	keys := []string{"user:1", "user:2", "user:10", "users", "session:1", "user:[x]"}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"user:*", []string{"user:1", "user:2", "user:10", "user:[x]"}},
+		{"user:?", []string{"user:1", "user:2"}},
+		{"user:[12]", []string{"user:1", "user:2"}},
+		{`user:\[x\]`, []string{"user:[x]"}},
+		{"*:1", []string{"user:1", "session:1"}},
+		{"missing*", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			ctx := context.Background()
+			c := NewMemoryCache()
+			for _, key := range keys {
+				if err := c.Set(ctx, key, key, 0); err != nil {
+					t.Fatalf("Set: %v", err)
+				}
+			}
+
+			deleted, err := c.DeletePattern(ctx, tt.pattern)
+			if err != nil || deleted != int64(len(tt.want)) {
+				t.Fatalf("DeletePattern = %d, %v; want %d", deleted, err, len(tt.want))
+			}
+			for _, key := range keys {
+				exists, _ := c.Exists(ctx, key)
+				if want := !slices.Contains(tt.want, key); exists != want {
+					t.Errorf("Exists(%s) = %v, want %v", key, exists, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryCacheInvalidateByTags(t *testing.T) {
+	ctx := context.Background()
+	clock := NewManualClock(time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC))
+	c := NewMemoryCache(WithClock(clock))
+
+	tagged := map[string][]string{
+		"a": {"red"},
+		"b": {"red", "blue"},
+		"c": {"blue"},
+		"d": nil,
+	}
+	for key, tags := range tagged {
+		if err := c.SetWithTags(ctx, key, key, time.Minute, tags); err != nil {
+			t.Fatalf("SetWithTags: %v", err)
+		}
+	}
+	// As in Redis, rewriting a key keeps it under the tags it had.
+	if err := c.Set(ctx, "c", "c", time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	if err := c.InvalidateByTags(ctx, []string{"blue", "unknown"}); err != nil {
+		t.Fatalf("InvalidateByTags: %v", err)
+	}
+	for key, want := range map[string]bool{"a": true, "b": false, "c": false, "d": true} {
+		if exists, _ := c.Exists(ctx, key); exists != want {
+			t.Errorf("after blue: Exists(%s) = %v, want %v", key, exists, want)
+		}
+	}
+
+	if err := c.InvalidateByTags(ctx, []string{"red"}); err != nil {
+		t.Fatalf("InvalidateByTags: %v", err)
+	}
+	if exists, _ := c.Exists(ctx, "a"); exists {
+		t.Error("after red: a still exists")
+	}
+	if got := c.Len(); got != 1 {
+		t.Errorf("Len = %d, want 1", got)
+	}
+}
+
+func TestMemoryCacheWarm(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache()
+
+	err := c.Warm(ctx, []WarmupKey{
+		{Key: "a", Value: 1, Tags: []string{"t"}},
+		{Key: "bad", Value: make(chan int)},
+		{Key: "b", Value: 2},
+		{Key: "worse", Value: func() {}},
+	})
+
+	var warmErr *WarmError
+	if !errors.As(err, &warmErr) {
+		t.Fatalf("Warm = %v, want a *WarmError", err)
+	}
+	report := warmErr.Report
+	if report.Total != 4 || report.Succeeded != 2 || len(report.Failed) != 2 {
+		t.Fatalf("report = %+v, want 2 of 4 succeeded", report)
+	}
+	if report.Failed[0].Key != "bad" || report.Failed[1].Key != "worse" {
+		t.Errorf("failed keys = %v, want bad and worse", report.Failed)
+	}
+
+	for key, want := range map[string]bool{"a": true, "b": true, "bad": false, "worse": false} {
+		if exists, _ := c.Exists(ctx, key); exists != want {
+			t.Errorf("Exists(%s) = %v, want %v", key, exists, want)
+		}
+	}
+	if err := c.InvalidateByTags(ctx, []string{"t"}); err != nil {
+		t.Fatalf("InvalidateByTags: %v", err)
+	}
+	if exists, _ := c.Exists(ctx, "a"); exists {
+		t.Error("warmed key lost its tags")
+	}
+
+	if err := c.Warm(ctx, []WarmupKey{{Key: "c", Value: 3}}); err != nil {
+		t.Errorf("Warm = %v, want nil when every key is written", err)
+	}
+}
+
+func TestMemoryCacheMetrics(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	c := NewMemoryCache(WithClock(clock))
+
+	var got int
+	_ = c.Set(ctx, "user:1", 1, 0)
+	_ = c.Get(ctx, "user:1", &got)
+	_ = c.Get(ctx, "user:2", &got)
+
+	clock.Advance(time.Minute)
+	window := c.ResetMetrics()
+	if window.Hits != 1 || window.Misses != 1 || window.TotalOps != 3 || !window.Since.Equal(start) {
+		t.Errorf("reset window = %+v, want 1 hit, 1 miss, 3 ops since start", window)
+	}
+	if user := window.Namespaces["user"]; user.Hits != 1 || user.Misses != 1 {
+		t.Errorf("user namespace = %+v, want 1 hit and 1 miss", user)
+	}
+
+	_ = c.Get(ctx, "user:1", &got)
+	window = c.WindowMetrics()
+	if window.Hits != 1 || window.Misses != 0 || window.TotalOps != 1 || !window.Since.Equal(start.Add(time.Minute)) {
+		t.Errorf("new window = %+v, want 1 hit since the reset", window)
+	}
+
+	lifetime := c.GetMetrics()
+	if lifetime.Hits != 2 || lifetime.Misses != 1 || lifetime.TotalOps != 4 || !lifetime.Since.Equal(start) {
+		t.Errorf("lifetime = %+v, want 2 hits, 1 miss, 4 ops since start", lifetime)
+	}
+	if lifetime.HitRate < 0.66 || lifetime.HitRate > 0.67 {
+		t.Errorf("HitRate = %v, want 2/3", lifetime.HitRate)
+	}
+}
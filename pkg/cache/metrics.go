@@ -0,0 +1,217 @@
+package cache
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	opGet              = "get"
+	opSet              = "set"
+	opDelete           = "delete"
+	opDeletePattern    = "delete_pattern"
+	opExists           = "exists"
+	opSetWithTags      = "set_with_tags"
+	opInvalidateByTags = "invalidate_by_tags"
+	opLoad             = "load"
+	opPublish          = "publish"
+	opGetMany          = "get_many"
+	opSetMany          = "set_many"
+	opDeleteMany       = "delete_many"
+	opWarm             = "warm"
+	opFetch            = "fetch"
+	opLock             = "lock"
+	opLeaderboard      = "leaderboard"
+	opCounter          = "counter"
+	opGetOrLoad        = "get_or_load"
+)
+
+type opResult int
+
+const (
+	resultOK opResult = iota
+	resultHit
+	resultMiss
+	resultError
+	// resultStale is a hit on a value past its soft TTL.
+	resultStale
+)
+
+// noNamespace groups keys that have no `namespace:` segment.
+const noNamespace = "_"
+
+type counters struct {
+	hits   atomic.Int64
+	stale  atomic.Int64
+	misses atomic.Int64
+	errors atomic.Int64
+	ops    atomic.Int64
+	nanos  atomic.Int64
+}
+
+func (c *counters) add(result opResult, duration time.Duration) {
+	c.ops.Add(1)
+	c.nanos.Add(int64(duration))
+	switch result {
+	case resultHit:
+		c.hits.Add(1)
+	case resultStale:
+		c.hits.Add(1)
+		c.stale.Add(1)
+	case resultMiss:
+		c.misses.Add(1)
+	case resultError:
+		c.errors.Add(1)
+	}
+}
+
+func (c *counters) snapshot() CacheMetrics {
+	metrics := CacheMetrics{
+		Hits:      c.hits.Load(),
+		StaleHits: c.stale.Load(),
+		Misses:    c.misses.Load(),
+		Errors:    c.errors.Load(),
+		TotalOps:  c.ops.Load(),
+	}
+	if lookups := metrics.Hits + metrics.Misses; lookups > 0 {
+		metrics.HitRate = float64(metrics.Hits) / float64(lookups)
+	}
+	if metrics.TotalOps > 0 {
+		metrics.AverageTime = time.Duration(c.nanos.Load() / metrics.TotalOps)
+	}
+	return metrics
+}
+
+// metricsSet holds totals plus breakdowns by operation and key namespace.
+type metricsSet struct {
+	since      time.Time
+	total      counters
+	rawBytes   atomic.Int64
+	compressed atomic.Int64
+	mu         sync.RWMutex
+	operations map[string]*counters
+	namespaces map[string]*counters
+}
+
+func newMetricsSet(since time.Time) *metricsSet {
+	return &metricsSet{
+		since:      since,
+		operations: make(map[string]*counters),
+		namespaces: make(map[string]*counters),
+	}
+}
+
+func (s *metricsSet) add(op, namespace string, result opResult, duration time.Duration) {
+	s.total.add(result, duration)
+	s.counter(s.operations, op).add(result, duration)
+	s.counter(s.namespaces, namespace).add(result, duration)
+}
+
+func (s *metricsSet) addError(op, namespace string) {
+	s.total.errors.Add(1)
+	s.counter(s.operations, op).errors.Add(1)
+	s.counter(s.namespaces, namespace).errors.Add(1)
+}
+
+func (s *metricsSet) counter(m map[string]*counters, name string) *counters {
+	s.mu.RLock()
+	c, ok := m[name]
+	s.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := m[name]; ok {
+		return c
+	}
+	c = &counters{}
+	m[name] = c
+	return c
+}
+
+func (s *metricsSet) snapshot() CacheMetrics {
+	metrics := s.total.snapshot()
+	metrics.Since = s.since
+	if compressed := s.compressed.Load(); compressed > 0 {
+		metrics.CompressionRatio = float64(s.rawBytes.Load()) / float64(compressed)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	metrics.Operations = make(map[string]CacheMetrics, len(s.operations))
+	for name, c := range s.operations {
+		metrics.Operations[name] = c.snapshot()
+	}
+	metrics.Namespaces = make(map[string]CacheMetrics, len(s.namespaces))
+	for name, c := range s.namespaces {
+		metrics.Namespaces[name] = c.snapshot()
+	}
+	return metrics
+}
+
+// metricsRecorder keeps per-instance counters for the lifetime of a cache
+// and for a window that can be reset independently, e.g. per dashboard
+// refresh or per test.
+type metricsRecorder struct {
+	now      func() time.Time
+	lifetime *metricsSet
+	window   atomic.Pointer[metricsSet]
+}
+
+func newMetricsRecorder(now func() time.Time) *metricsRecorder {
+	r := &metricsRecorder{
+		now:      now,
+		lifetime: newMetricsSet(now()),
+	}
+	r.window.Store(newMetricsSet(now()))
+	return r
+}
+
+func (r *metricsRecorder) record(op, key string, result opResult, duration time.Duration) {
+	namespace := r.namespace(key)
+	r.lifetime.add(op, namespace, result, duration)
+	r.window.Load().add(op, namespace, result, duration)
+}
+
+// recordError counts an error found after the operation itself was recorded,
+// such as a value that fails to decode.
+func (r *metricsRecorder) recordError(op, key string) {
+	namespace := r.namespace(key)
+	r.lifetime.addError(op, namespace)
+	r.window.Load().addError(op, namespace)
+}
+
+func (r *metricsRecorder) recordCompression(rawBytes, compressedBytes int) {
+	for _, set := range []*metricsSet{r.lifetime, r.window.Load()} {
+		set.rawBytes.Add(int64(rawBytes))
+		set.compressed.Add(int64(compressedBytes))
+	}
+}
+
+func (r *metricsRecorder) snapshot() CacheMetrics {
+	return r.lifetime.snapshot()
+}
+
+func (r *metricsRecorder) windowSnapshot() CacheMetrics {
+	return r.window.Load().snapshot()
+}
+
+// resetWindow starts a new window and returns the one it replaced.
+func (r *metricsRecorder) resetWindow() CacheMetrics {
+	return r.window.Swap(newMetricsSet(r.now())).snapshot()
+}
+
+// namespace returns the first segment of key, which is relative to the
+// cache's prefix.
+func (r *metricsRecorder) namespace(key string) string {
+	namespace, _, found := strings.Cut(key, ":")
+	if !found || namespace == "" {
+		return noNamespace
+	}
+	return namespace
+}
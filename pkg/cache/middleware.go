@@ -0,0 +1,381 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Zorynix/shared/pkg/logger"
+)
+
+// Middleware decorates a Cache, e.g. to log, trace or audit its calls. The
+// result should implement TaggedCache when the wrapped cache does, so
+// wrapping does not lose SetWithTags.
+type Middleware func(Cache) Cache
+
+// Chain wraps cache in middlewares. The first middleware is the outermost,
+// so Chain(c, a, b) is a(b(c)).
+func Chain(cache Cache, middlewares ...Middleware) Cache {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		cache = middlewares[i](cache)
+	}
+	return cache
+}
+
+// Event describes one cache call, or one key of a batch call. Batch calls
+// produce an event per key with the call's duration split evenly between
+// them.
+type Event struct {
+	// Operation is the operation name used in metrics ("get", "set",
+	// "get_many", ...).
+	Operation string
+	// Key is the key, or the pattern for delete_pattern and the
+	// comma-separated tags for invalidate_by_tags.
+	Key string
+	// Hit reports whether a get, exists or get_many found the key. A
+	// tombstone counts as a hit.
+	Hit      bool
+	Err      error
+	Duration time.Duration
+}
+
+func (e Event) result() opResult {
+	switch {
+	case e.Err != nil:
+		return resultError
+	case e.Operation != opGet && e.Operation != opExists && e.Operation != opGetMany:
+		return resultOK
+	case e.Hit:
+		return resultHit
+	default:
+		return resultMiss
+	}
+}
+
+// Hook is called after every cache call.
+type Hook func(ctx context.Context, event Event)
+
+// HookMiddleware calls hooks, in order, after every call through the cache.
+// Misses are reported with Hit false and no Err.
+func HookMiddleware(hooks ...Hook) Middleware {
+	return func(next Cache) Cache {
+		c := &hookedCache{next: next, hooks: hooks}
+		if tagged, ok := next.(TaggedCache); ok {
+			return &taggedHookedCache{hookedCache: c, next: tagged}
+		}
+		return c
+	}
+}
+
+// LoggingMiddleware logs every call with Logger.LogCacheOperation, and
+// failed calls at warn level.
+func LoggingMiddleware(log *logger.Logger) Middleware {
+	return HookMiddleware(func(ctx context.Context, event Event) {
+		log.LogCacheOperation(ctx, event.Operation, event.Key, event.Hit, event.Duration)
+		if event.Err != nil {
+			log.WithContext(ctx).Warn("Cache operation failed",
+				zap.String("cache_operation", event.Operation),
+				zap.String("cache_key", event.Key),
+				logger.Err(event.Err),
+			)
+		}
+	})
+}
+
+// MetricsMiddleware reports calls to m under service, with the same metric
+// names and labels as RedisCache, e.g. for caches that do not report their
+// own metrics.
+func MetricsMiddleware(m *Metrics, service string) Middleware {
+	return HookMiddleware(func(_ context.Context, event Event) {
+		m.operations.WithLabelValues(service, event.Operation, event.result().String()).Inc()
+		m.duration.WithLabelValues(service, event.Operation).Observe(event.Duration.Seconds())
+	})
+}
+
+type hookedCache struct {
+	next  Cache
+	hooks []Hook
+}
+
+// Unwrap returns the wrapped cache.
+func (c *hookedCache) Unwrap() Cache {
+	return c.next
+}
+
+func (c *hookedCache) emit(ctx context.Context, op, key string, hit bool, err error, duration time.Duration) {
+	if errors.Is(err, ErrCacheKeyNotFound) {
+		err = nil
+	}
+	if errors.Is(err, ErrKnownNotFound) {
+		hit, err = true, nil
+	}
+	event := Event{Operation: op, Key: key, Hit: hit, Err: err, Duration: duration}
+	for _, hook := range c.hooks {
+		hook(ctx, event)
+	}
+}
+
+func (c *hookedCache) emitBatch(ctx context.Context, op string, keys []string, start time.Time, hit func(i int) bool, err error) {
+	if len(keys) == 0 {
+		return
+	}
+	perKey := time.Since(start) / time.Duration(len(keys))
+	for i, key := range keys {
+		c.emit(ctx, op, key, hit(i), err, perKey)
+	}
+}
+
+func (c *hookedCache) Get(ctx context.Context, key string, dest interface{}) error {
+	start := time.Now()
+	err := c.next.Get(ctx, key, dest)
+	c.emit(ctx, opGet, key, err == nil, err, time.Since(start))
+	return err
+}
+
+func (c *hookedCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	start := time.Now()
+	err := c.next.Set(ctx, key, value, ttl)
+	c.emit(ctx, opSet, key, false, err, time.Since(start))
+	return err
+}
+
+func (c *hookedCache) Delete(ctx context.Context, key string) error {
+	start := time.Now()
+	err := c.next.Delete(ctx, key)
+	c.emit(ctx, opDelete, key, false, err, time.Since(start))
+	return err
+}
+
+func (c *hookedCache) DeletePattern(ctx context.Context, pattern string) (int64, error) {
+	start := time.Now()
+	deleted, err := c.next.DeletePattern(ctx, pattern)
+	c.emit(ctx, opDeletePattern, pattern, false, err, time.Since(start))
+	return deleted, err
+}
+
+func (c *hookedCache) Exists(ctx context.Context, key string) (bool, error) {
+	start := time.Now()
+	exists, err := c.next.Exists(ctx, key)
+	c.emit(ctx, opExists, key, exists, err, time.Since(start))
+	return exists, err
+}
+
+func (c *hookedCache) GetMetrics() CacheMetrics {
+	return c.next.GetMetrics()
+}
+
+func (c *hookedCache) Warm(ctx context.Context, keys []WarmupKey) error {
+	start := time.Now()
+	err := c.next.Warm(ctx, keys)
+
+	var warmErr *WarmError
+	failed := make(map[string]error)
+	if errors.As(err, &warmErr) {
+		for _, failure := range warmErr.Report.Failed {
+			failed[failure.Key] = failure.Err
+		}
+	}
+
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = key.Key
+	}
+	if len(names) > 0 {
+		perKey := time.Since(start) / time.Duration(len(names))
+		for _, name := range names {
+			keyErr := err
+			if warmErr != nil {
+				keyErr = failed[name]
+			}
+			c.emit(ctx, opWarm, name, false, keyErr, perKey)
+		}
+	}
+	return err
+}
+
+func (c *hookedCache) InvalidateByTags(ctx context.Context, tags []string) error {
+	start := time.Now()
+	err := c.next.InvalidateByTags(ctx, tags)
+	c.emit(ctx, opInvalidateByTags, strings.Join(tags, ","), false, err, time.Since(start))
+	return err
+}
+
+func (c *hookedCache) GetOrLoad(ctx context.Context, key string, dest interface{}, ttl time.Duration, loader LoaderFunc) error {
+	start := time.Now()
+	err := c.next.GetOrLoad(ctx, key, dest, ttl, loader)
+	c.emit(ctx, opGetOrLoad, key, false, err, time.Since(start))
+	return err
+}
+
+func (c *hookedCache) GetMany(ctx context.Context, keys []string) (map[string]Value, []string, error) {
+	start := time.Now()
+	values, missing, err := c.next.GetMany(ctx, keys)
+
+	absent := make(map[string]bool, len(missing))
+	for _, key := range missing {
+		absent[key] = true
+	}
+	c.emitBatch(ctx, opGetMany, keys, start, func(i int) bool {
+		return err == nil && !absent[keys[i]]
+	}, err)
+	return values, missing, err
+}
+
+func (c *hookedCache) SetMany(ctx context.Context, items []Item) error {
+	start := time.Now()
+	err := c.next.SetMany(ctx, items)
+
+	keys := make([]string, len(items))
+	for i, item := range items {
+		keys[i] = item.Key
+	}
+	c.emitBatch(ctx, opSetMany, keys, start, func(int) bool { return false }, err)
+	return err
+}
+
+func (c *hookedCache) DeleteMany(ctx context.Context, keys []string) (int64, error) {
+	start := time.Now()
+	deleted, err := c.next.DeleteMany(ctx, keys)
+	c.emitBatch(ctx, opDeleteMany, keys, start, func(int) bool { return false }, err)
+	return deleted, err
+}
+
+type taggedHookedCache struct {
+	*hookedCache
+	next TaggedCache
+}
+
+func (c *taggedHookedCache) SetWithTags(ctx context.Context, key string, value interface{}, ttl time.Duration, tags []string) error {
+	start := time.Now()
+	err := c.next.SetWithTags(ctx, key, value, ttl, tags)
+	c.emit(ctx, opSetWithTags, key, false, err, time.Since(start))
+	return err
+}
+
+// KeyPrefixMiddleware adds prefix and a ":" to every key and pattern, e.g. to
+// give a module its own keyspace inside a shared cache. Keys returned by
+// GetMany are reported without the prefix, and tombstone errors name and
+// resolve the key without it. Tags are not rewritten.
+func KeyPrefixMiddleware(prefix string) Middleware {
+	return func(next Cache) Cache {
+		c := &prefixedCache{next: next, prefix: prefix + ":"}
+		if tagged, ok := next.(TaggedCache); ok {
+			return &taggedPrefixedCache{prefixedCache: c, next: tagged}
+		}
+		return c
+	}
+}
+
+type prefixedCache struct {
+	next   Cache
+	prefix string
+}
+
+// Unwrap returns the wrapped cache.
+func (c *prefixedCache) Unwrap() Cache {
+	return c.next
+}
+
+func (c *prefixedCache) key(key string) string {
+	return c.prefix + key
+}
+
+func (c *prefixedCache) keys(keys []string) []string {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = c.key(key)
+	}
+	return prefixed
+}
+
+func (c *prefixedCache) Get(ctx context.Context, key string, dest interface{}) error {
+	return c.next.Get(withCallerKey(ctx, key, c.key(key)), c.key(key), dest)
+}
+
+func (c *prefixedCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return c.next.Set(ctx, c.key(key), value, ttl)
+}
+
+func (c *prefixedCache) Delete(ctx context.Context, key string) error {
+	return c.next.Delete(ctx, c.key(key))
+}
+
+func (c *prefixedCache) DeletePattern(ctx context.Context, pattern string) (int64, error) {
+	return c.next.DeletePattern(ctx, c.key(pattern))
+}
+
+func (c *prefixedCache) Exists(ctx context.Context, key string) (bool, error) {
+	return c.next.Exists(ctx, c.key(key))
+}
+
+func (c *prefixedCache) GetMetrics() CacheMetrics {
+	return c.next.GetMetrics()
+}
+
+func (c *prefixedCache) Warm(ctx context.Context, keys []WarmupKey) error {
+	prefixed := make([]WarmupKey, len(keys))
+	for i, key := range keys {
+		key.Key = c.key(key.Key)
+		prefixed[i] = key
+	}
+
+	err := c.next.Warm(ctx, prefixed)
+
+	var warmErr *WarmError
+	if errors.As(err, &warmErr) {
+		for i := range warmErr.Report.Failed {
+			failure := &warmErr.Report.Failed[i]
+			failure.Key = strings.TrimPrefix(failure.Key, c.prefix)
+		}
+	}
+	return err
+}
+
+func (c *prefixedCache) InvalidateByTags(ctx context.Context, tags []string) error {
+	return c.next.InvalidateByTags(ctx, tags)
+}
+
+func (c *prefixedCache) GetOrLoad(ctx context.Context, key string, dest interface{}, ttl time.Duration, loader LoaderFunc) error {
+	return c.next.GetOrLoad(withCallerKey(ctx, key, c.key(key)), c.key(key), dest, ttl, loader)
+}
+
+func (c *prefixedCache) GetMany(ctx context.Context, keys []string) (map[string]Value, []string, error) {
+	values, missing, err := c.next.GetMany(ctx, c.keys(keys))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stripped := make(map[string]Value, len(values))
+	for key, value := range values {
+		stripped[strings.TrimPrefix(key, c.prefix)] = value
+	}
+	for i, key := range missing {
+		missing[i] = strings.TrimPrefix(key, c.prefix)
+	}
+	return stripped, missing, nil
+}
+
+func (c *prefixedCache) SetMany(ctx context.Context, items []Item) error {
+	prefixed := make([]Item, len(items))
+	for i, item := range items {
+		item.Key = c.key(item.Key)
+		prefixed[i] = item
+	}
+	return c.next.SetMany(ctx, prefixed)
+}
+
+func (c *prefixedCache) DeleteMany(ctx context.Context, keys []string) (int64, error) {
+	return c.next.DeleteMany(ctx, c.keys(keys))
+}
+
+type taggedPrefixedCache struct {
+	*prefixedCache
+	next TaggedCache
+}
+
+func (c *taggedPrefixedCache) SetWithTags(ctx context.Context, key string, value interface{}, ttl time.Duration, tags []string) error {
+	return c.next.SetWithTags(ctx, c.key(key), value, ttl, tags)
+}
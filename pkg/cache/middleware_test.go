@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func newTestRedisCache(t *testing.T, keyPrefix string) (*RedisCache, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	return connectTestCache(t, server, Config{KeyPrefix: keyPrefix}), server
+}
+
+// connectTestCache opens a RedisCache on server, so several instances can
+// share one Redis.
+func connectTestCache(t *testing.T, server *miniredis.Miniredis, config Config, opts ...Option) *RedisCache {
+	t.Helper()
+	config.Addr = server.Addr()
+	opts = append([]Option{WithRegisterer(prometheus.NewRegistry())}, opts...)
+	c, err := NewRedisCache(config, "test", opts...)
+	if err != nil {
+		t.Fatalf("NewRedisCache: %v", err)
+	}
+	t.Cleanup(func() { _ = c.client.Close() })
+	return c
+}
+
+func TestKeyPrefixMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		cachePrefix string
+		prefix      string
+		stored      string
+	}{
+		{"no cache prefix", "", "module", "module:key"},
+		{"different prefix", "app", "module", "app:module:key"},
+		{"same prefix", "app", "app", "app:app:key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			redisCache, server := newTestRedisCache(t, tt.cachePrefix)
+			cache := Chain(redisCache, KeyPrefixMiddleware(tt.prefix))
+
+			// A key outside the middleware's keyspace that looks like one
+			// inside it must not be touched.
+			if err := redisCache.Set(ctx, "key", "outside", 0); err != nil {
+				t.Fatalf("Set outside: %v", err)
+			}
+			if err := cache.Set(ctx, "key", "inside", 0); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+			if !server.Exists(tt.stored) {
+				t.Fatalf("stored keys = %v, want %q", server.Keys(), tt.stored)
+			}
+
+			var got string
+			if err := cache.Get(ctx, "key", &got); err != nil || got != "inside" {
+				t.Fatalf("Get = %q, %v; want inside", got, err)
+			}
+
+			values, missing, err := cache.GetMany(ctx, []string{"key", "absent"})
+			if err != nil {
+				t.Fatalf("GetMany: %v", err)
+			}
+			if _, ok := values["key"]; !ok || !slices.Equal(missing, []string{"absent"}) {
+				t.Fatalf("GetMany = %v, %v; want key found and absent missing", values, missing)
+			}
+
+			deleted, err := cache.DeletePattern(ctx, "*")
+			if err != nil || deleted != 1 {
+				t.Fatalf("DeletePattern = %d, %v; want 1", deleted, err)
+			}
+			if err := redisCache.Get(ctx, "key", &got); err != nil || got != "outside" {
+				t.Fatalf("outside key = %q, %v; want it untouched", got, err)
+			}
+		})
+	}
+}
+
+func TestMiddlewareKeepsSetWithTags(t *testing.T) {
+	ctx := context.Background()
+	redisCache, _ := newTestRedisCache(t, "app")
+
+	var events []Event
+	hook := func(_ context.Context, event Event) {
+		events = append(events, event)
+	}
+
+	tests := []struct {
+		name  string
+		cache Cache
+	}{
+		{"hook", Chain(redisCache, HookMiddleware(hook))},
+		{"prefix", Chain(redisCache, KeyPrefixMiddleware("module"))},
+		{"chain", Chain(redisCache, HookMiddleware(hook), KeyPrefixMiddleware("module"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tagged, ok := tt.cache.(TaggedCache)
+			if !ok {
+				t.Fatalf("%T does not implement TaggedCache", tt.cache)
+			}
+			if err := tagged.SetWithTags(ctx, "key", 1, time.Minute, []string{tt.name}); err != nil {
+				t.Fatalf("SetWithTags: %v", err)
+			}
+			if err := tagged.InvalidateByTags(ctx, []string{tt.name}); err != nil {
+				t.Fatalf("InvalidateByTags: %v", err)
+			}
+			var got int
+			if err := tagged.Get(ctx, "key", &got); !errors.Is(err, ErrCacheKeyNotFound) {
+				t.Fatalf("Get after invalidation = %v, want ErrCacheKeyNotFound", err)
+			}
+		})
+	}
+
+	if !slices.ContainsFunc(events, func(e Event) bool { return e.Operation == opSetWithTags }) {
+		t.Errorf("no %s event in %v", opSetWithTags, events)
+	}
+	if _, ok := Chain(NewMemoryCache(), HookMiddleware()).(TaggedCache); !ok {
+		t.Error("wrapped MemoryCache lost SetWithTags")
+	}
+	if _, ok := Chain(&stubCache{}, HookMiddleware()).(TaggedCache); ok {
+		t.Error("wrapping a cache without SetWithTags added it")
+	}
+}
@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	apperrors "github.com/Zorynix/shared/pkg/errors"
+)
+
+// tombstoneID marks a key as known to be absent from the source. It sits
+// outside the codec, compression and envelope header ranges.
+const tombstoneID byte = 0x11
+
+// ErrKnownNotFound is matched by every error returned for a tombstone, in
+// addition to the namespace's AppError.
+var ErrKnownNotFound = fmt.Errorf("cache key known not found")
+
+// existsScript is EXISTS that reports tombstones as absent. STRLEN comes
+// first so large values are not read.
+var existsScript = redis.NewScript(`
+local kind = redis.call("type", KEYS[1])["ok"]
+if kind == "none" then
+	return 0
+end
+if kind == "string" and redis.call("strlen", KEYS[1]) == 1 and redis.call("get", KEYS[1]) == ARGV[1] then
+	return 0
+end
+return 1
+`)
+
+var defaultNotFoundErrors = map[string]*apperrors.AppError{
+	"user": apperrors.ErrUserNotFoundError,
+	"test": apperrors.ErrTestNotFoundError,
+}
+
+// WithNotFoundError maps tombstones in a key namespace (the first segment of
+// the key as the caller passed it, before KeyPrefixMiddleware prefixes) to
+// err. "user" and "test" map to ErrUserNotFoundError and
+// ErrTestNotFoundError; other namespaces default to ErrRecordNotFoundError.
+func WithNotFoundError(namespace string, err *apperrors.AppError) Option {
+	return func(o *options) {
+		if o.notFound == nil {
+			o.notFound = make(map[string]*apperrors.AppError)
+		}
+		o.notFound[namespace] = err
+	}
+}
+
+// NotFoundError is returned when a key holds a tombstone. errors.Is matches
+// both ErrKnownNotFound and the AppError for the key's namespace. Key is the
+// key as the caller passed it.
+type NotFoundError struct {
+	Key string
+	Err *apperrors.AppError
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Key, e.Err.Error())
+}
+
+func (e *NotFoundError) Unwrap() []error {
+	return []error{ErrKnownNotFound, e.Err}
+}
+
+// SetNotFound stores a tombstone for key, so reads return a *NotFoundError
+// for ttl instead of missing and falling through to the source. The TTL is
+// usually much shorter than for real values, so newly created records show
+// up quickly.
+func (c *RedisCache) SetNotFound(ctx context.Context, key string, ttl time.Duration) error {
+	return c.setBytes(ctx, key, []byte{tombstoneID}, ttl)
+}
+
+func isTombstone(data []byte) bool {
+	return len(data) == 1 && data[0] == tombstoneID
+}
+
+type callerKeyKey struct{}
+
+// callerKey maps the key a cache receives back to the key the caller passed
+// before KeyPrefixMiddleware added its prefixes.
+type callerKey struct {
+	key      string
+	prefixed string
+}
+
+// withCallerKey records that key reaches the next cache as prefixed, keeping
+// the original key when key was itself prefixed by an outer middleware.
+func withCallerKey(ctx context.Context, key, prefixed string) context.Context {
+	if outer, ok := ctx.Value(callerKeyKey{}).(callerKey); ok && outer.prefixed == key {
+		key = outer.key
+	}
+	return context.WithValue(ctx, callerKeyKey{}, callerKey{key: key, prefixed: prefixed})
+}
+
+// notFoundError resolves the namespace from the caller's key. ctx is only
+// trusted for key itself, so calls a loader makes with the same ctx for
+// other keys are unaffected.
+func (c *RedisCache) notFoundError(ctx context.Context, key string) error {
+	if caller, ok := ctx.Value(callerKeyKey{}).(callerKey); ok && caller.prefixed == key {
+		key = caller.key
+	}
+
+	namespace := c.stats.namespace(key)
+	if err, ok := c.notFound[namespace]; ok {
+		return &NotFoundError{Key: key, Err: err}
+	}
+	if err, ok := defaultNotFoundErrors[namespace]; ok {
+		return &NotFoundError{Key: key, Err: err}
+	}
+	return &NotFoundError{Key: key, Err: apperrors.ErrRecordNotFoundError}
+}
+
+// isNotFound reports whether a loader error means the record does not exist.
+func isNotFound(err error) bool {
+	var appErr *apperrors.AppError
+	if !errors.As(err, &appErr) {
+		return false
+	}
+	switch appErr.Code {
+	case apperrors.ErrRecordNotFound, apperrors.ErrUserNotFound, apperrors.ErrTestNotFound:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	apperrors "github.com/Zorynix/shared/pkg/errors"
+)
+
+func TestGetOrLoadTombstone(t *testing.T) {
+	teamNotFound := apperrors.NewAppError(apperrors.ErrRecordNotFound, "Team not found")
+
+	tests := []struct {
+		name       string
+		middleware []Middleware
+		key        string
+		want       *apperrors.AppError
+	}{
+		{"user namespace", nil, "user:1", apperrors.ErrUserNotFoundError},
+		{"test namespace", nil, "test:1", apperrors.ErrTestNotFoundError},
+		{"registered namespace", nil, "team:1", teamNotFound},
+		{"other namespace", nil, "order:1", apperrors.ErrRecordNotFoundError},
+		{"under a key prefix", []Middleware{KeyPrefixMiddleware("module")}, "user:1", apperrors.ErrUserNotFoundError},
+		{"under nested key prefixes", []Middleware{KeyPrefixMiddleware("outer"), HookMiddleware(), KeyPrefixMiddleware("inner")}, "team:1", teamNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			server := miniredis.RunT(t)
+			redisCache := connectTestCache(t, server, Config{KeyPrefix: "app", NegativeTTL: time.Minute}, WithNotFoundError("team", teamNotFound))
+			cache := Chain(redisCache, tt.middleware...)
+
+			loads := 0
+			loader := func(context.Context) (interface{}, error) {
+				loads++
+				return nil, tt.want
+			}
+
+			var got string
+			if err := cache.GetOrLoad(ctx, tt.key, &got, time.Minute, loader); !errors.Is(err, tt.want) {
+				t.Fatalf("first GetOrLoad = %v, want the loader's %v", err, tt.want)
+			}
+
+			for _, read := range []func() error{
+				func() error { return cache.GetOrLoad(ctx, tt.key, &got, time.Minute, loader) },
+				func() error { return cache.Get(ctx, tt.key, &got) },
+			} {
+				err := read()
+				var notFound *NotFoundError
+				if !errors.As(err, &notFound) {
+					t.Fatalf("read = %v, want a *NotFoundError", err)
+				}
+				if notFound.Key != tt.key || notFound.Err != tt.want {
+					t.Errorf("NotFoundError = %q, %v; want %q, %v", notFound.Key, notFound.Err, tt.key, tt.want)
+				}
+				if !errors.Is(err, ErrKnownNotFound) || !errors.Is(err, tt.want) {
+					t.Errorf("errors.Is(%v) misses ErrKnownNotFound or %v", err, tt.want)
+				}
+			}
+			if loads != 1 {
+				t.Errorf("loader called %d times, want 1", loads)
+			}
+		})
+	}
+}
+
+func TestTombstoneReads(t *testing.T) {
+	ctx := context.Background()
+	c, server := newTestRedisCache(t, "app")
+
+	if err := c.Set(ctx, "user:1", "alice", time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := c.SetNotFound(ctx, "user:2", time.Minute); err != nil {
+		t.Fatalf("SetNotFound: %v", err)
+	}
+	// A real one-byte value must not be taken for a tombstone.
+	server.Set("app:user:3", "x")
+
+	for key, want := range map[string]bool{"user:1": true, "user:2": false, "user:3": true, "user:4": false} {
+		if exists, err := c.Exists(ctx, key); err != nil || exists != want {
+			t.Errorf("Exists(%s) = %v, %v; want %v", key, exists, err, want)
+		}
+	}
+
+	values, missing, err := c.GetMany(ctx, []string{"user:1", "user:2", "user:4"})
+	if err != nil {
+		t.Fatalf("GetMany: %v", err)
+	}
+	if _, ok := values["user:1"]; !ok || len(values) != 1 {
+		t.Errorf("values = %v, want only user:1", values)
+	}
+	if !slices.Equal(missing, []string{"user:4"}) {
+		t.Errorf("missing = %v, want only user:4", missing)
+	}
+
+	server.FastForward(2 * time.Minute)
+	if _, missing, _ := c.GetMany(ctx, []string{"user:2"}); !slices.Equal(missing, []string{"user:2"}) {
+		t.Errorf("missing after expiry = %v, want user:2", missing)
+	}
+}
+
+func TestCallerKeyScopedToKey(t *testing.T) {
+	ctx := withCallerKey(context.Background(), "user:1", "module:user:1")
+	c, _ := newTestRedisCache(t, "app")
+
+	// A loader reusing ctx for another key gets that key's namespace.
+	var notFound *NotFoundError
+	if err := c.notFoundError(ctx, "team:1"); !errors.As(err, &notFound) || notFound.Key != "team:1" || notFound.Err != apperrors.ErrRecordNotFoundError {
+		t.Errorf("notFoundError(team:1) = %v, want team:1 as a record", err)
+	}
+	if err := c.notFoundError(ctx, "module:user:1"); !errors.As(err, &notFound) || notFound.Key != "user:1" || notFound.Err != apperrors.ErrUserNotFoundError {
+		t.Errorf("notFoundError(module:user:1) = %v, want user:1 as a user", err)
+	}
+}
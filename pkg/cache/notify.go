@@ -0,0 +1,249 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type KeyEventType string
+
+const (
+	KeyEventSet    KeyEventType = "set"
+	KeyEventDelete KeyEventType = "delete"
+	// KeyEventExpired is only delivered by NotificationKeyspace; the
+	// library cannot see keys expire.
+	KeyEventExpired KeyEventType = "expired"
+)
+
+// KeyEvent reports a change to a key. Key has the cache's prefix removed.
+// Keys the library uses internally (tag indexes, locks) are never reported.
+type KeyEvent struct {
+	Type KeyEventType
+	Key  string
+}
+
+type KeyEventHandler func(event KeyEvent)
+
+type NotificationSource int
+
+const (
+	// NotificationKeyspace listens to Redis keyspace notifications, which
+	// see every change including expiry and writes from other clients. The
+	// server needs notify-keyspace-events to include "Kg$x" (see
+	// SubscribeOptions.Configure).
+	NotificationKeyspace NotificationSource = iota
+	// NotificationChannel listens to events the library publishes itself
+	// from caches with Config.KeyEvents set, for servers where CONFIG is
+	// not available. Only set and delete events are delivered, and only
+	// for writes made through RedisCache.
+	NotificationChannel
+)
+
+const (
+	keyEventsChannel = "__keyevents"
+	// keyspaceEventFlags are the notify-keyspace-events classes needed for
+	// set, delete, expired and evicted events.
+	keyspaceEventFlags = "Kg$xe"
+)
+
+type SubscribeOptions struct {
+	Source NotificationSource
+	// Types limits delivery to these event types. Empty delivers all.
+	Types []KeyEventType
+	// Configure adds the flags keyspace notifications need to the server's
+	// notify-keyspace-events setting before subscribing.
+	Configure bool
+}
+
+// keyEventMessage is published on the library-managed channel.
+type keyEventMessage struct {
+	Type KeyEventType `json:"type"`
+	Keys []string     `json:"keys"`
+}
+
+// Subscription delivers key events to a handler until closed. Events are
+// delivered one at a time, in the order they arrive.
+type Subscription struct {
+	pubsubs []*redis.PubSub
+	wg      sync.WaitGroup
+	once    sync.Once
+}
+
+// Subscribe calls handler for changes to keys matching pattern, a Redis glob
+// relative to the cache's prefix ("*" for all keys).
+func (c *RedisCache) Subscribe(ctx context.Context, pattern string, handler KeyEventHandler, opts SubscribeOptions) (*Subscription, error) {
+	fullPattern := c.buildKey(pattern)
+
+	types := make(map[KeyEventType]bool, len(opts.Types))
+	for _, t := range opts.Types {
+		types[t] = true
+	}
+	deliver := func(event KeyEvent) {
+		if len(types) == 0 || types[event.Type] {
+			handler(event)
+		}
+	}
+
+	sub := &Subscription{}
+
+	switch opts.Source {
+	case NotificationKeyspace:
+		nodes := []redis.UniversalClient{c.client}
+		if cluster, ok := c.client.(*redis.ClusterClient); ok {
+			// Keyspace notifications are local to each node.
+			var mu sync.Mutex
+			nodes = nil
+			err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+				mu.Lock()
+				nodes = append(nodes, node)
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to list cluster nodes: %w", err)
+			}
+		}
+
+		channelPrefix := fmt.Sprintf("__keyspace@%d__:", c.db)
+		for _, node := range nodes {
+			if opts.Configure {
+				if err := configureKeyspaceEvents(ctx, node); err != nil {
+					_ = sub.Close()
+					return nil, err
+				}
+			}
+
+			pubsub := node.PSubscribe(ctx, channelPrefix+fullPattern)
+			if _, err := pubsub.Receive(ctx); err != nil {
+				_ = pubsub.Close()
+				_ = sub.Close()
+				return nil, fmt.Errorf("failed to subscribe to keyspace notifications: %w", err)
+			}
+			sub.listen(pubsub, func(msg *redis.Message) {
+				eventType, ok := keyspaceEventType(msg.Payload)
+				if !ok {
+					return
+				}
+				key := c.stripKey(strings.TrimPrefix(msg.Channel, channelPrefix))
+				if !isInternalKey(key) {
+					deliver(KeyEvent{Type: eventType, Key: key})
+				}
+			})
+		}
+	case NotificationChannel:
+		pubsub := c.client.Subscribe(ctx, c.buildKey(keyEventsChannel))
+		if _, err := pubsub.Receive(ctx); err != nil {
+			_ = pubsub.Close()
+			return nil, fmt.Errorf("failed to subscribe to key events channel: %w", err)
+		}
+		sub.listen(pubsub, func(msg *redis.Message) {
+			var event keyEventMessage
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				return
+			}
+			for _, key := range event.Keys {
+				if !matchGlob(fullPattern, key) {
+					continue
+				}
+				if relative := c.stripKey(key); !isInternalKey(relative) {
+					deliver(KeyEvent{Type: event.Type, Key: relative})
+				}
+			}
+		})
+	default:
+		return nil, fmt.Errorf("unknown notification source %d", opts.Source)
+	}
+
+	return sub, nil
+}
+
+func (s *Subscription) listen(pubsub *redis.PubSub, handle func(msg *redis.Message)) {
+	s.pubsubs = append(s.pubsubs, pubsub)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for msg := range pubsub.Channel() {
+			handle(msg)
+		}
+	}()
+}
+
+// Close unsubscribes and waits for the handler to return.
+func (s *Subscription) Close() error {
+	var err error
+	s.once.Do(func() {
+		for _, pubsub := range s.pubsubs {
+			if closeErr := pubsub.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+		s.wg.Wait()
+	})
+	return err
+}
+
+// isInternalKey reports whether key, relative to the cache's prefix, is one
+// the library keeps for itself.
+func isInternalKey(key string) bool {
+	return strings.HasPrefix(key, internalKeyPrefix)
+}
+
+// keyspaceEventType maps a keyspace notification payload (the command or
+// event name) to a KeyEventType.
+func keyspaceEventType(payload string) (KeyEventType, bool) {
+	switch payload {
+	case "set":
+		return KeyEventSet, true
+	case "del", "evicted":
+		return KeyEventDelete, true
+	case "expired":
+		return KeyEventExpired, true
+	default:
+		return "", false
+	}
+}
+
+// configureKeyspaceEvents adds keyspaceEventFlags to the node's
+// notify-keyspace-events setting, keeping any flags already enabled.
+func configureKeyspaceEvents(ctx context.Context, node redis.UniversalClient) error {
+	current, err := node.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		return fmt.Errorf("failed to read notify-keyspace-events: %w", err)
+	}
+
+	flags := ""
+	if len(current) == 2 {
+		flags, _ = current[1].(string)
+	}
+	for _, flag := range keyspaceEventFlags {
+		if !strings.ContainsRune(flags, flag) {
+			flags += string(flag)
+		}
+	}
+
+	if err := node.ConfigSet(ctx, "notify-keyspace-events", flags).Err(); err != nil {
+		return fmt.Errorf("failed to set notify-keyspace-events: %w", err)
+	}
+	return nil
+}
+
+// publishKeyEvent announces changes on the library-managed channel when
+// Config.KeyEvents is set. It is best effort, like invalidation messages.
+func (c *RedisCache) publishKeyEvent(ctx context.Context, eventType KeyEventType, fullKeys ...string) {
+	if !c.keyEvents || len(fullKeys) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(keyEventMessage{Type: eventType, Keys: fullKeys})
+	if err != nil {
+		return
+	}
+	if err := c.client.Publish(ctx, c.buildKey(keyEventsChannel), payload).Err(); err != nil {
+		c.recordError(opPublish, "")
+	}
+}
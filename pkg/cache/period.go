@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+// Period splits time into UTC buckets for leaderboards and counters.
+type Period string
+
+const (
+	// PeriodAllTime is a single bucket that never rolls over.
+	PeriodAllTime Period = ""
+	PeriodHourly  Period = "hourly"
+	PeriodDaily   Period = "daily"
+	PeriodWeekly  Period = "weekly"
+)
+
+func (p Period) Valid() bool {
+	switch p {
+	case PeriodAllTime, PeriodHourly, PeriodDaily, PeriodWeekly:
+		return true
+	}
+	return false
+}
+
+// Start returns the start of the bucket containing t. Weeks start on Monday.
+func (p Period) Start(t time.Time) time.Time {
+	t = t.UTC()
+	switch p {
+	case PeriodHourly:
+		return t.Truncate(time.Hour)
+	case PeriodDaily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case PeriodWeekly:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	default:
+		return time.Time{}
+	}
+}
+
+// Next returns the start of the bucket after the one containing t.
+func (p Period) Next(t time.Time) time.Time {
+	start := p.Start(t)
+	switch p {
+	case PeriodHourly:
+		return start.Add(time.Hour)
+	case PeriodDaily:
+		return start.AddDate(0, 0, 1)
+	case PeriodWeekly:
+		return start.AddDate(0, 0, 7)
+	default:
+		return time.Time{}
+	}
+}
+
+// Bucket identifies the bucket containing t, e.g. "2024-05-06T13",
+// "2024-05-06" or "2024-W19". Weekly buckets use ISO week numbers.
+func (p Period) Bucket(t time.Time) string {
+	t = t.UTC()
+	switch p {
+	case PeriodHourly:
+		return t.Format("2006-01-02T15")
+	case PeriodDaily:
+		return t.Format("2006-01-02")
+	case PeriodWeekly:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	default:
+		return "all"
+	}
+}
+
+// Buckets returns the buckets from the one containing from up to and
+// including the one containing to.
+func (p Period) Buckets(from, to time.Time) []string {
+	starts := p.starts(from, to)
+	buckets := make([]string, len(starts))
+	for i, start := range starts {
+		buckets[i] = p.Bucket(start)
+	}
+	return buckets
+}
+
+func (p Period) starts(from, to time.Time) []time.Time {
+	if p == PeriodAllTime {
+		return []time.Time{{}}
+	}
+
+	var starts []time.Time
+	for t := p.Start(from); !t.After(to); t = p.Next(t) {
+		starts = append(starts, t)
+	}
+	return starts
+}
+
+// expireAt returns when the bucket containing t should be dropped: retention
+// after the bucket closes. PeriodAllTime buckets never expire.
+func (p Period) expireAt(t time.Time, retention time.Duration) time.Time {
+	if p == PeriodAllTime {
+		return time.Time{}
+	}
+	return p.Next(t).Add(retention)
+}
+
+// length is the nominal duration of one bucket, used as the default
+// retention.
+func (p Period) length() time.Duration {
+	switch p {
+	case PeriodHourly:
+		return time.Hour
+	case PeriodDaily:
+		return 24 * time.Hour
+	case PeriodWeekly:
+		return 7 * 24 * time.Hour
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPeriodBoundaries(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no tzdata: %v", err)
+	}
+	utc := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatalf("parse %s: %v", s, err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name      string
+		period    Period
+		t         time.Time
+		wantStart time.Time
+		wantNext  time.Time
+		want      string
+	}{
+		{
+			name:      "hour before spring forward",
+			period:    PeriodHourly,
+			t:         utc("2024-03-10T06:59:59Z").In(newYork), // 01:59:59 EST
+			wantStart: utc("2024-03-10T06:00:00Z"),
+			wantNext:  utc("2024-03-10T07:00:00Z"),
+			want:      "2024-03-10T06",
+		},
+		{
+			name:      "hour after spring forward",
+			period:    PeriodHourly,
+			t:         utc("2024-03-10T07:00:00Z").In(newYork), // 03:00 EDT
+			wantStart: utc("2024-03-10T07:00:00Z"),
+			wantNext:  utc("2024-03-10T08:00:00Z"),
+			want:      "2024-03-10T07",
+		},
+		{
+			name:      "first 01:30 on fall back",
+			period:    PeriodHourly,
+			t:         utc("2024-11-03T05:30:00Z").In(newYork), // 01:30 EDT
+			wantStart: utc("2024-11-03T05:00:00Z"),
+			wantNext:  utc("2024-11-03T06:00:00Z"),
+			want:      "2024-11-03T05",
+		},
+		{
+			name:      "second 01:30 on fall back",
+			period:    PeriodHourly,
+			t:         utc("2024-11-03T06:30:00Z").In(newYork), // 01:30 EST
+			wantStart: utc("2024-11-03T06:00:00Z"),
+			wantNext:  utc("2024-11-03T07:00:00Z"),
+			want:      "2024-11-03T06",
+		},
+		{
+			name:      "local evening is the next UTC day",
+			period:    PeriodDaily,
+			t:         utc("2024-03-11T03:30:00Z").In(newYork), // 23:30 EDT on the 10th
+			wantStart: utc("2024-03-11T00:00:00Z"),
+			wantNext:  utc("2024-03-12T00:00:00Z"),
+			want:      "2024-03-11",
+		},
+		{
+			name:      "day of fall back is 24 UTC hours",
+			period:    PeriodDaily,
+			t:         utc("2024-11-03T12:00:00Z").In(newYork),
+			wantStart: utc("2024-11-03T00:00:00Z"),
+			wantNext:  utc("2024-11-04T00:00:00Z"),
+			want:      "2024-11-03",
+		},
+		{
+			name:      "sunday ends the week",
+			period:    PeriodWeekly,
+			t:         utc("2024-05-05T23:59:59Z"),
+			wantStart: utc("2024-04-29T00:00:00Z"),
+			wantNext:  utc("2024-05-06T00:00:00Z"),
+			want:      "2024-W18",
+		},
+		{
+			name:      "monday starts the week",
+			period:    PeriodWeekly,
+			t:         utc("2024-05-06T00:00:00Z"),
+			wantStart: utc("2024-05-06T00:00:00Z"),
+			wantNext:  utc("2024-05-13T00:00:00Z"),
+			want:      "2024-W19",
+		},
+		{
+			name:      "local sunday evening is the UTC monday week",
+			period:    PeriodWeekly,
+			t:         utc("2024-05-06T01:00:00Z").In(newYork), // 21:00 EDT sunday
+			wantStart: utc("2024-05-06T00:00:00Z"),
+			wantNext:  utc("2024-05-13T00:00:00Z"),
+			want:      "2024-W19",
+		},
+		{
+			name:      "december week in the next ISO year",
+			period:    PeriodWeekly,
+			t:         utc("2024-12-31T12:00:00Z"),
+			wantStart: utc("2024-12-30T00:00:00Z"),
+			wantNext:  utc("2025-01-06T00:00:00Z"),
+			want:      "2025-W01",
+		},
+		{
+			name:      "january week in the previous ISO year",
+			period:    PeriodWeekly,
+			t:         utc("2021-01-03T12:00:00Z"),
+			wantStart: utc("2020-12-28T00:00:00Z"),
+			wantNext:  utc("2021-01-04T00:00:00Z"),
+			want:      "2020-W53",
+		},
+		{
+			name:   "all time",
+			period: PeriodAllTime,
+			t:      utc("2024-05-06T12:00:00Z"),
+			want:   "all",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.period.Start(tt.t); !got.Equal(tt.wantStart) {
+				t.Errorf("Start = %v, want %v", got, tt.wantStart)
+			}
+			if got := tt.period.Next(tt.t); !got.Equal(tt.wantNext) {
+				t.Errorf("Next = %v, want %v", got, tt.wantNext)
+			}
+			if got := tt.period.Bucket(tt.t); got != tt.want {
+				t.Errorf("Bucket = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeriodBuckets(t *testing.T) {
+	tests := []struct {
+		name     string
+		period   Period
+		from, to time.Time
+		want     []string
+	}{
+		{
+			name:   "hours across fall back",
+			period: PeriodHourly,
+			from:   time.Date(2024, 11, 3, 4, 30, 0, 0, time.UTC),
+			to:     time.Date(2024, 11, 3, 7, 0, 0, 0, time.UTC),
+			want:   []string{"2024-11-03T04", "2024-11-03T05", "2024-11-03T06", "2024-11-03T07"},
+		},
+		{
+			name:   "weeks across the ISO year",
+			period: PeriodWeekly,
+			from:   time.Date(2024, 12, 25, 0, 0, 0, 0, time.UTC),
+			to:     time.Date(2025, 1, 8, 0, 0, 0, 0, time.UTC),
+			want:   []string{"2024-W52", "2025-W01", "2025-W02"},
+		},
+		{
+			name:   "single day",
+			period: PeriodDaily,
+			from:   time.Date(2024, 5, 6, 1, 0, 0, 0, time.UTC),
+			to:     time.Date(2024, 5, 6, 23, 0, 0, 0, time.UTC),
+			want:   []string{"2024-05-06"},
+		},
+		{
+			name:   "to before from",
+			period: PeriodDaily,
+			from:   time.Date(2024, 5, 7, 0, 0, 0, 0, time.UTC),
+			to:     time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC),
+			want:   []string{},
+		},
+		{
+			name:   "all time",
+			period: PeriodAllTime,
+			from:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:     time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC),
+			want:   []string{"all"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.period.Buckets(tt.from, tt.to); !slices.Equal(got, tt.want) {
+				t.Errorf("Buckets = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeriodExpireAt(t *testing.T) {
+	at := time.Date(2024, 5, 8, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		period Period
+		want   time.Time
+	}{
+		{PeriodHourly, time.Date(2024, 5, 8, 17, 0, 0, 0, time.UTC)},
+		{PeriodDaily, time.Date(2024, 5, 9, 1, 0, 0, 0, time.UTC)},
+		{PeriodWeekly, time.Date(2024, 5, 13, 1, 0, 0, 0, time.UTC)},
+		{PeriodAllTime, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		if got := tt.period.expireAt(at, time.Hour); !got.Equal(tt.want) {
+			t.Errorf("%q.expireAt = %v, want %v", tt.period, got, tt.want)
+		}
+	}
+}
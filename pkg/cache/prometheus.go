@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics holds the Prometheus collectors for caches. Every cache created
+// with the same Metrics shares its vectors and is told apart by the service
+// label, so any number of caches can coexist in one registry.
+type Metrics struct {
+	operations *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+	layerHits  *prometheus.CounterVec
+
+	compressionRatio *prometheus.HistogramVec
+	breakerState     *prometheus.GaugeVec
+}
+
+func NewMetrics(namespace string) *Metrics {
+	return &Metrics{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_operations_total",
+			Help:      "Total number of cache operations by result (hit, miss, ok, error)",
+		}, []string{"service", "operation", "result"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "cache_operation_duration_seconds",
+			Help:      "Duration of cache operations",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"service", "operation"}),
+		layerHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_layer_hits_total",
+			Help:      "Total number of cache hits per layer of a layered cache",
+		}, []string{"service", "layer"}),
+		compressionRatio: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "cache_compression_ratio",
+			Help:      "Ratio of uncompressed to compressed size for values above the compression threshold",
+			Buckets:   []float64{1, 1.5, 2, 3, 5, 8, 13, 20},
+		}, []string{"service"}),
+		breakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "cache_circuit_breaker_state",
+			Help:      "State of the cache circuit breaker (0 closed, 1 open, 2 half-open)",
+		}, []string{"service"}),
+	}
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.operations.Describe(ch)
+	m.duration.Describe(ch)
+	m.layerHits.Describe(ch)
+	m.compressionRatio.Describe(ch)
+	m.breakerState.Describe(ch)
+}
+
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.operations.Collect(ch)
+	m.duration.Collect(ch)
+	m.layerHits.Collect(ch)
+	m.compressionRatio.Collect(ch)
+	m.breakerState.Collect(ch)
+}
+
+type registeredMetricsKey struct {
+	registerer prometheus.Registerer
+	namespace  string
+}
+
+var (
+	registeredMetricsMu sync.Mutex
+	registeredMetrics   = make(map[registeredMetricsKey]*Metrics)
+)
+
+// metricsFor returns the Metrics registered with reg under namespace,
+// creating and registering them on first use.
+func metricsFor(reg prometheus.Registerer, namespace string) (*Metrics, error) {
+	registeredMetricsMu.Lock()
+	defer registeredMetricsMu.Unlock()
+
+	key := registeredMetricsKey{registerer: reg, namespace: namespace}
+	if m, ok := registeredMetrics[key]; ok {
+		return m, nil
+	}
+
+	m := NewMetrics(namespace)
+	if err := reg.Register(m); err != nil {
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if errors.As(err, &alreadyRegistered) {
+			if existing, ok := alreadyRegistered.ExistingCollector.(*Metrics); ok {
+				registeredMetrics[key] = existing
+				return existing, nil
+			}
+		}
+		return nil, err
+	}
+
+	registeredMetrics[key] = m
+	return m, nil
+}
+
+func (r opResult) String() string {
+	switch r {
+	case resultHit:
+		return "hit"
+	case resultStale:
+		return "stale"
+	case resultMiss:
+		return "miss"
+	case resultError:
+		return "error"
+	default:
+		return "ok"
+	}
+}
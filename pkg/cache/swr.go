@@ -0,0 +1,237 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Stale-while-revalidate entries wrap the encoded value in a header holding
+// the soft expiry and the time the last load took:
+//
+//	[swrEnvelopeID][soft expiry, unix ms][load duration, ms][encoded value]
+//
+// Plain Get strips the header, so these keys stay readable as normal values.
+const (
+	swrEnvelopeID        byte = 0x10
+	swrHeaderSize             = 17
+	swrRefreshLockPrefix      = internalKeyPrefix + "refresh_lock:"
+)
+
+type SWRConfig struct {
+	// SoftTTL is how long a value is fresh. Past it, reads return the stale
+	// value and trigger a background refresh.
+	SoftTTL time.Duration `yaml:"soft_ttl" validate:"required"`
+	// HardTTL is how long the value is kept at all. Defaults to twice
+	// SoftTTL.
+	HardTTL time.Duration `yaml:"hard_ttl"`
+	// Beta enables XFetch probabilistic early refresh when above zero:
+	// fresh values are refreshed early with a probability that grows as the
+	// soft expiry nears and with how long the value took to load. 1 is the
+	// usual choice.
+	Beta float64 `yaml:"beta" validate:"min=0"`
+	// RefreshTimeout bounds a background refresh, and a load on a miss,
+	// which is shared between callers and so runs detached from their
+	// contexts. Defaults to 30s.
+	RefreshTimeout time.Duration `yaml:"refresh_timeout"`
+}
+
+const defaultSWRRefreshTimeout = 30 * time.Second
+
+// SWRCache serves values past their soft TTL while refreshing them in the
+// background, so popular keys never make every reader block on the loader
+// at once. At most one refresh per key runs in this process, and across
+// instances when the RedisCache has a LoadLockTTL.
+type SWRCache struct {
+	cache      *RedisCache
+	config     SWRConfig
+	loads      flightGroup
+	refreshing sync.Map
+}
+
+func NewSWRCache(cache *RedisCache, config SWRConfig) *SWRCache {
+	if config.HardTTL <= config.SoftTTL {
+		config.HardTTL = 2 * config.SoftTTL
+	}
+	if config.RefreshTimeout <= 0 {
+		config.RefreshTimeout = defaultSWRRefreshTimeout
+	}
+	return &SWRCache{cache: cache, config: config}
+}
+
+type swrEntry struct {
+	softExpiry time.Time
+	delta      time.Duration
+	value      []byte
+}
+
+func encodeSWR(entry swrEntry) []byte {
+	data := make([]byte, swrHeaderSize, swrHeaderSize+len(entry.value))
+	data[0] = swrEnvelopeID
+	binary.BigEndian.PutUint64(data[1:9], uint64(entry.softExpiry.UnixMilli()))
+	binary.BigEndian.PutUint64(data[9:17], uint64(entry.delta.Milliseconds()))
+	return append(data, entry.value...)
+}
+
+func decodeSWR(data []byte) (swrEntry, bool) {
+	if len(data) < swrHeaderSize || data[0] != swrEnvelopeID {
+		return swrEntry{}, false
+	}
+	return swrEntry{
+		softExpiry: time.UnixMilli(int64(binary.BigEndian.Uint64(data[1:9]))),
+		delta:      time.Duration(binary.BigEndian.Uint64(data[9:17])) * time.Millisecond,
+		value:      data[swrHeaderSize:],
+	}, true
+}
+
+// Fetch reads key into dest. Fresh values are returned as is; stale ones are
+// returned while a background refresh runs; on a miss loader runs
+// synchronously, shared between concurrent callers.
+func (s *SWRCache) Fetch(ctx context.Context, key string, dest interface{}, loader LoaderFunc) error {
+	start := time.Now()
+	c := s.cache
+
+	data, err := c.client.Get(ctx, c.buildKey(key)).Bytes()
+	switch {
+	case err == nil && isTombstone(data):
+		c.record(opFetch, key, start, resultHit)
+		return c.notFoundError(ctx, key)
+	case err == nil:
+		entry, ok := decodeSWR(data)
+		if !ok {
+			// Written with plain Set: serve it, but replace it with an
+			// envelope in the background.
+			entry = swrEntry{value: data}
+		}
+
+		now := time.Now()
+		switch {
+		case now.After(entry.softExpiry):
+			c.record(opFetch, key, start, resultStale)
+			s.refreshAsync(ctx, key, loader)
+		case s.refreshEarly(entry, now):
+			c.record(opFetch, key, start, resultHit)
+			s.refreshAsync(ctx, key, loader)
+		default:
+			c.record(opFetch, key, start, resultHit)
+		}
+		return s.decode(entry.value, key, dest)
+	case errors.Is(err, redis.Nil):
+		c.record(opFetch, key, start, resultMiss)
+	default:
+		// Serve from the source when Redis is unavailable.
+		c.record(opFetch, key, start, resultError)
+	}
+
+	value, err := s.loads.Do(ctx, key, func() ([]byte, error) {
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.config.RefreshTimeout)
+		defer cancel()
+		return s.load(loadCtx, key, loader)
+	})
+	if err != nil {
+		return err
+	}
+	return s.decode(value, key, dest)
+}
+
+// Set writes value as a fresh entry.
+func (s *SWRCache) Set(ctx context.Context, key string, value interface{}) error {
+	data, err := s.cache.encode(value)
+	if err != nil {
+		s.cache.recordError(opSet, key)
+		return fmt.Errorf("cache marshal error: %w", err)
+	}
+	return s.write(ctx, key, data, 0)
+}
+
+// refreshEarly implements XFetch: refresh when
+// now - delta*beta*ln(rand) >= softExpiry.
+func (s *SWRCache) refreshEarly(entry swrEntry, now time.Time) bool {
+	if s.config.Beta <= 0 || entry.delta <= 0 {
+		return false
+	}
+	gap := -float64(entry.delta) * s.config.Beta * math.Log(1-rand.Float64())
+	return !now.Add(time.Duration(gap)).Before(entry.softExpiry)
+}
+
+func (s *SWRCache) refreshAsync(ctx context.Context, key string, loader LoaderFunc) {
+	if _, running := s.refreshing.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+
+	go func() {
+		defer s.refreshing.Delete(key)
+		defer func() {
+			// Nobody waits on a background refresh to re-raise a loader
+			// panic to, so it is counted as a failed refresh.
+			if r := recover(); r != nil {
+				s.cache.recordError(opFetch, key)
+			}
+		}()
+
+		// The refresh outlives the read that triggered it but keeps its
+		// values, such as trace and user IDs, for the loader.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.config.RefreshTimeout)
+		defer cancel()
+
+		c := s.cache
+		if c.loadLockTTL > 0 {
+			lockKey := c.buildKey(swrRefreshLockPrefix + key)
+			token, acquired, err := c.acquireLock(ctx, lockKey, s.config.RefreshTimeout)
+			if err != nil || !acquired {
+				return
+			}
+			defer func() {
+				_, _ = releaseLock(context.Background(), c.client, lockKey, token)
+			}()
+		}
+
+		if _, err := s.loads.Do(ctx, key, func() ([]byte, error) {
+			return s.load(ctx, key, loader)
+		}); err != nil {
+			s.cache.recordError(opFetch, key)
+		}
+	}()
+}
+
+func (s *SWRCache) load(ctx context.Context, key string, loader LoaderFunc) ([]byte, error) {
+	start := time.Now()
+	value, err := loader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	delta := time.Since(start)
+
+	data, err := s.cache.encode(value)
+	if err != nil {
+		return nil, fmt.Errorf("cache marshal error: %w", err)
+	}
+
+	// The value is returned even if caching it fails.
+	_ = s.write(ctx, key, data, delta)
+	return data, nil
+}
+
+func (s *SWRCache) write(ctx context.Context, key string, data []byte, delta time.Duration) error {
+	entry := swrEntry{
+		softExpiry: time.Now().Add(s.config.SoftTTL),
+		delta:      delta,
+		value:      data,
+	}
+	return s.cache.setBytes(ctx, key, encodeSWR(entry), s.config.HardTTL)
+}
+
+func (s *SWRCache) decode(data []byte, key string, dest interface{}) error {
+	if err := decodeValue(data, dest); err != nil {
+		s.cache.recordError(opFetch, key)
+		return fmt.Errorf("cache unmarshal error: %w", err)
+	}
+	return nil
+}
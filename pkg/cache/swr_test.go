@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type swrTestKey struct{}
+
+// setStale writes value under key as an SWR entry past its soft TTL.
+func setStale(t *testing.T, c *RedisCache, key string, value interface{}) {
+	t.Helper()
+	data, err := c.encode(value)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	entry := swrEntry{softExpiry: time.Now().Add(-time.Second), value: data}
+	if err := c.setBytes(context.Background(), key, encodeSWR(entry), time.Minute); err != nil {
+		t.Fatalf("setBytes: %v", err)
+	}
+}
+
+func TestSWRRefreshKeepsCallerValues(t *testing.T) {
+	c, _ := newTestRedisCache(t, "app")
+	s := NewSWRCache(c, SWRConfig{SoftTTL: time.Minute})
+	setStale(t, c, "key", "old")
+
+	refreshed := make(chan interface{}, 1)
+	loader := func(ctx context.Context) (interface{}, error) {
+		select {
+		case refreshed <- ctx.Value(swrTestKey{}):
+		default:
+		}
+		return "new", ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), swrTestKey{}, "trace-1"))
+	var got string
+	if err := s.Fetch(ctx, "key", &got, loader); err != nil || got != "old" {
+		t.Fatalf("Fetch = %q, %v; want the stale value", got, err)
+	}
+	// The refresh must outlive the read that triggered it.
+	cancel()
+
+	select {
+	case value := <-refreshed:
+		if value != "trace-1" {
+			t.Errorf("refresh loader got ctx value %v, want the caller's", value)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stale read did not refresh")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if err := s.Fetch(context.Background(), "key", &got, loader); err != nil {
+			t.Fatalf("Fetch: %v", err)
+		}
+		if got == "new" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Fetch = %q after the refresh, want new", got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSWRRefreshFailureCounted(t *testing.T) {
+	c, _ := newTestRedisCache(t, "app")
+	s := NewSWRCache(c, SWRConfig{SoftTTL: time.Minute})
+
+	for name, loader := range map[string]LoaderFunc{
+		"error": func(context.Context) (interface{}, error) { return nil, errors.New("source down") },
+		"panic": func(context.Context) (interface{}, error) { panic("loader bug") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			setStale(t, c, "key", "old")
+			before := c.GetMetrics().Errors
+
+			var got string
+			if err := s.Fetch(context.Background(), "key", &got, loader); err != nil || got != "old" {
+				t.Fatalf("Fetch = %q, %v; want the stale value", got, err)
+			}
+
+			deadline := time.Now().Add(5 * time.Second)
+			for c.GetMetrics().Errors == before {
+				if time.Now().After(deadline) {
+					t.Fatal("failed refresh not counted as an error")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
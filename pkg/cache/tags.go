@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Tag index entries live in one sorted set per tag, scored by the tagged
+// key's expiry time in unix milliseconds (+inf for keys without a TTL). This
+// lets every write prune members that already expired and keeps the tag set
+// itself alive exactly as long as its longest-lived member.
+var addTagScript = redis.NewScript(`
+redis.call("zremrangebyscore", KEYS[1], "-inf", ARGV[3])
+redis.call("zadd", KEYS[1], ARGV[2], ARGV[1])
+local last = redis.call("zrange", KEYS[1], -1, -1, "WITHSCORES")
+if last[2] == "inf" then
+	redis.call("persist", KEYS[1])
+else
+	redis.call("pexpireat", KEYS[1], last[2])
+end
+return 1
+`)
+
+const tagKeyPrefix = internalKeyPrefix + "tags:"
+
+// SetWithTags stores value like Set and records key under every tag. With a
+// single Redis the writes share one MULTI transaction, so the value is never
+// visible without its tags. With Config.ClusterAddrs the value and each tag
+// set usually live in different hash slots, and go-redis runs one
+// transaction per slot: if one fails, the value can be left without some of
+// its tags or the other way round, and SetWithTags returns the error.
+func (c *RedisCache) SetWithTags(ctx context.Context, key string, value interface{}, ttl time.Duration, tags []string) error {
+	if len(tags) == 0 {
+		return c.Set(ctx, key, value, ttl)
+	}
+
+	start := time.Now()
+
+	data, err := c.encode(value)
+	if err != nil {
+		c.recordError(opSetWithTags, key)
+		return fmt.Errorf("cache marshal error: %w", err)
+	}
+
+	fullKey := c.buildKey(key)
+	now := time.Now()
+	score := tagScore(now, ttl)
+
+	_, err = c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, fullKey, data, ttl)
+		for _, tag := range tags {
+			addTagScript.Eval(ctx, pipe, []string{c.tagKey(tag)}, fullKey, score, now.UnixMilli())
+		}
+		return nil
+	})
+	if err != nil {
+		c.record(opSetWithTags, key, start, resultError)
+		return fmt.Errorf("cache set with tags error: %w", err)
+	}
+
+	c.record(opSetWithTags, key, start, resultOK)
+	c.publishKeyEvent(ctx, KeyEventSet, fullKey)
+
+	return nil
+}
+
+// InvalidateByTags deletes every live key recorded under tags, whichever
+// instance wrote it, and drops the tag sets.
+func (c *RedisCache) InvalidateByTags(ctx context.Context, tags []string) error {
+	_, err := c.invalidateTags(ctx, tags)
+	return err
+}
+
+// invalidateTags returns the full keys it deleted.
+func (c *RedisCache) invalidateTags(ctx context.Context, tags []string) ([]string, error) {
+	start := time.Now()
+
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	var keysToDelete []string
+
+	for _, tag := range tags {
+		tagKey := c.tagKey(tag)
+
+		// Read and drop the tag atomically so keys tagged concurrently end
+		// up either in this invalidation or in a fresh tag set.
+		var members *redis.StringSliceCmd
+		_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			members = pipe.ZRangeByScore(ctx, tagKey, &redis.ZRangeBy{Min: "(" + now, Max: "+inf"})
+			pipe.Del(ctx, tagKey)
+			return nil
+		})
+		if err != nil {
+			c.record(opInvalidateByTags, "", start, resultError)
+			return nil, fmt.Errorf("cache tag lookup error for tag %s: %w", tag, err)
+		}
+
+		keysToDelete = append(keysToDelete, members.Val()...)
+	}
+
+	if len(keysToDelete) == 0 {
+		c.record(opInvalidateByTags, "", start, resultOK)
+		return nil, nil
+	}
+
+	cmds, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keysToDelete {
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+
+	var removed []string
+	for i, cmd := range cmds {
+		if intCmd, ok := cmd.(*redis.IntCmd); ok && intCmd.Err() == nil && intCmd.Val() > 0 {
+			removed = append(removed, keysToDelete[i])
+		}
+	}
+	c.publishKeyEvent(ctx, KeyEventDelete, removed...)
+
+	if err != nil {
+		c.record(opInvalidateByTags, "", start, resultError)
+		return nil, fmt.Errorf("cache invalidation error: %w", err)
+	}
+
+	c.record(opInvalidateByTags, "", start, resultOK)
+
+	return keysToDelete, nil
+}
+
+// tagScore is the tag index score for a key written at now with ttl.
+func tagScore(now time.Time, ttl time.Duration) string {
+	if ttl <= 0 {
+		return "+inf"
+	}
+	return strconv.FormatInt(now.Add(ttl).UnixMilli(), 10)
+}
+
+func (c *RedisCache) tagKey(tag string) string {
+	return c.buildKey(tagKeyPrefix + tag)
+}
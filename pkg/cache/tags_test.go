@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAddTagScript(t *testing.T) {
+	type add struct {
+		member string
+		ttl    time.Duration
+	}
+
+	tests := []struct {
+		name        string
+		adds        []add
+		wantMembers []string
+		// wantTTL is zero when the tag set must not expire.
+		wantTTL time.Duration
+	}{
+		{
+			name:        "expires with its only member",
+			adds:        []add{{"a", time.Minute}},
+			wantMembers: []string{"a"},
+			wantTTL:     time.Minute,
+		},
+		{
+			name:        "follows the longest-lived member",
+			adds:        []add{{"a", time.Minute}, {"b", 5 * time.Minute}, {"c", 2 * time.Minute}},
+			wantMembers: []string{"a", "c", "b"},
+			wantTTL:     5 * time.Minute,
+		},
+		{
+			name:        "shrinks back when the longest-lived member is rewritten",
+			adds:        []add{{"a", time.Minute}, {"b", 5 * time.Minute}, {"b", 2 * time.Minute}},
+			wantMembers: []string{"a", "b"},
+			wantTTL:     2 * time.Minute,
+		},
+		{
+			name:        "prunes expired members",
+			adds:        []add{{"old", -time.Second}, {"new", time.Minute}},
+			wantMembers: []string{"new"},
+			wantTTL:     time.Minute,
+		},
+		{
+			name:        "persists for a member without TTL",
+			adds:        []add{{"a", time.Minute}, {"b", 0}},
+			wantMembers: []string{"a", "b"},
+		},
+		{
+			name:        "stays persistent after a member with TTL",
+			adds:        []add{{"b", 0}, {"a", time.Minute}},
+			wantMembers: []string{"a", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			c, _ := newTestRedisCache(t, "app")
+			tagKey := c.tagKey("t")
+			now := time.Now()
+
+			for _, a := range tt.adds {
+				score := tagScore(now, a.ttl)
+				if a.ttl < 0 {
+					// tagScore treats every TTL <= 0 as no expiry.
+					score = strconv.FormatInt(now.Add(a.ttl).UnixMilli(), 10)
+				}
+				if err := addTagScript.Run(ctx, c.client, []string{tagKey}, a.member, score, now.UnixMilli()).Err(); err != nil {
+					t.Fatalf("addTagScript: %v", err)
+				}
+			}
+
+			members, err := c.client.ZRange(ctx, tagKey, 0, -1).Result()
+			if err != nil {
+				t.Fatalf("ZRange: %v", err)
+			}
+			if !slices.Equal(members, tt.wantMembers) {
+				t.Errorf("members = %v, want %v", members, tt.wantMembers)
+			}
+
+			ttl, err := c.client.PTTL(ctx, tagKey).Result()
+			if err != nil {
+				t.Fatalf("PTTL: %v", err)
+			}
+			if tt.wantTTL == 0 {
+				if ttl != -1 {
+					t.Errorf("PTTL = %v, want no expiry", ttl)
+				}
+				return
+			}
+			if diff := (tt.wantTTL - ttl).Abs(); diff > 2*time.Second {
+				t.Errorf("PTTL = %v, want about %v", ttl, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestSetWithTagsIndexesKeys(t *testing.T) {
+	ctx := context.Background()
+	c, server := newTestRedisCache(t, "app")
+
+	if err := c.SetWithTags(ctx, "a", 1, time.Minute, []string{"red", "blue"}); err != nil {
+		t.Fatalf("SetWithTags: %v", err)
+	}
+	if err := c.SetWithTags(ctx, "b", 2, 0, []string{"red"}); err != nil {
+		t.Fatalf("SetWithTags: %v", err)
+	}
+
+	for tag, want := range map[string][]string{"red": {"app:a", "app:b"}, "blue": {"app:a"}} {
+		members, err := server.ZMembers(c.tagKey(tag))
+		if err != nil {
+			t.Fatalf("ZMembers %s: %v", tag, err)
+		}
+		if !slices.Equal(members, want) {
+			t.Errorf("%s members = %v, want %v", tag, members, want)
+		}
+	}
+	if ttl := server.TTL(c.tagKey("red")); ttl != 0 {
+		t.Errorf("red TTL = %v, want none for a member without TTL", ttl)
+	}
+
+	// The blue set expires together with a, its only member.
+	server.FastForward(2 * time.Minute)
+	if server.Exists(c.tagKey("blue")) {
+		t.Error("blue outlived its only member")
+	}
+
+	if err := c.InvalidateByTags(ctx, []string{"red"}); err != nil {
+		t.Fatalf("InvalidateByTags: %v", err)
+	}
+	if server.Exists("app:b") || server.Exists(c.tagKey("red")) {
+		t.Errorf("keys left after invalidating red: %v", server.Keys())
+	}
+}
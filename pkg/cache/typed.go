@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TypedCache wraps a Cache with a fixed value type so that call sites get
+// compile-time checking instead of passing interface{} destinations.
+type TypedCache[T any] struct {
+	cache Cache
+}
+
+func NewTypedCache[T any](cache Cache) *TypedCache[T] {
+	return &TypedCache[T]{cache: cache}
+}
+
+func (c *TypedCache[T]) Get(ctx context.Context, key string) (T, error) {
+	var value T
+	err := c.cache.Get(ctx, key, &value)
+	return value, err
+}
+
+func (c *TypedCache[T]) Set(ctx context.Context, key string, value T, ttl time.Duration) error {
+	return c.cache.Set(ctx, key, value, ttl)
+}
+
+func (c *TypedCache[T]) Delete(ctx context.Context, key string) error {
+	return c.cache.Delete(ctx, key)
+}
+
+func (c *TypedCache[T]) GetOrLoad(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	var value T
+	err := c.cache.GetOrLoad(ctx, key, &value, ttl, func(ctx context.Context) (interface{}, error) {
+		return loader(ctx)
+	})
+	return value, err
+}
+
+// GetMany returns the values found for keys. Keys that are missing from the
+// cache are left out of the result rather than reported as errors.
+func (c *TypedCache[T]) GetMany(ctx context.Context, keys []string) (map[string]T, error) {
+	encoded, _, err := c.cache.GetMany(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]T, len(encoded))
+	for key, data := range encoded {
+		var value T
+		if err := data.Decode(&value); err != nil {
+			return nil, fmt.Errorf("key %s: %w", key, err)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+func (c *TypedCache[T]) SetMany(ctx context.Context, values map[string]T, ttl time.Duration) error {
+	items := make([]Item, 0, len(values))
+	for key, value := range values {
+		items = append(items, Item{Key: key, Value: value, TTL: ttl})
+	}
+	return c.cache.SetMany(ctx, items)
+}
+
+// Unwrap returns the underlying untyped cache.
+func (c *TypedCache[T]) Unwrap() Cache {
+	return c.cache
+}
@@ -0,0 +1,244 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const defaultWarmBatchSize = 100
+
+type WarmOptions struct {
+	// BatchSize is the number of keys written per pipeline. Defaults to 100.
+	BatchSize int
+	// Concurrency is the number of pipelines in flight at once. Defaults
+	// to 1.
+	Concurrency int
+}
+
+type WarmFailure struct {
+	Key string
+	Err error
+}
+
+// WarmReport describes the outcome of a warm-up. Failed keys do not stop the
+// warm-up; they are listed here instead.
+type WarmReport struct {
+	Total     int
+	Succeeded int
+	Failed    []WarmFailure
+	// NotAttempted counts keys taken from the source but never written
+	// because ctx was done. The source is not read any further then, so
+	// keys it had yet to yield are not counted at all.
+	NotAttempted int
+	// Interrupted is ctx.Err() when the warm-up stopped early.
+	Interrupted error
+	Duration    time.Duration
+}
+
+// Err returns a *WarmError if any key failed or was not attempted, nil
+// otherwise.
+func (r *WarmReport) Err() error {
+	if len(r.Failed) == 0 && r.Interrupted == nil {
+		return nil
+	}
+	return &WarmError{Report: r}
+}
+
+// WarmError is returned by Warm when some keys could not be written. Use
+// errors.As to get at the full report.
+type WarmError struct {
+	Report *WarmReport
+}
+
+func (e *WarmError) Error() string {
+	if len(e.Report.Failed) == 0 {
+		return fmt.Sprintf("cache warmup stopped after %d keys, %d not attempted: %v",
+			e.Report.Total, e.Report.NotAttempted, e.Report.Interrupted)
+	}
+	first := e.Report.Failed[0]
+	return fmt.Sprintf("cache warmup failed for %d of %d keys, first %s: %v",
+		len(e.Report.Failed), e.Report.Total, first.Key, first.Err)
+}
+
+func (e *WarmError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Report.Failed)+1)
+	for _, failure := range e.Report.Failed {
+		errs = append(errs, failure.Err)
+	}
+	if e.Report.Interrupted != nil {
+		errs = append(errs, e.Report.Interrupted)
+	}
+	return errs
+}
+
+// Warm writes keys in pipelined batches and keeps going past failures. It
+// returns a *WarmError listing the keys that failed, if any.
+func (c *RedisCache) Warm(ctx context.Context, keys []WarmupKey) error {
+	return c.WarmWithOptions(ctx, keys, WarmOptions{}).Err()
+}
+
+func (c *RedisCache) WarmWithOptions(ctx context.Context, keys []WarmupKey, opts WarmOptions) *WarmReport {
+	return c.WarmFromLoader(ctx, func(yield func(WarmupKey, error) bool) {
+		for _, key := range keys {
+			if !yield(key, nil) {
+				return
+			}
+		}
+	}, opts)
+}
+
+// WarmFromLoader warms the cache from an iterator, so keys can be produced
+// lazily (e.g. streamed from a database cursor) instead of built up front.
+// An error yielded by source is recorded against the key yielded with it
+// and the warm-up continues. Once ctx is done it stops reading source and
+// counts the keys it holds as not attempted.
+func (c *RedisCache) WarmFromLoader(ctx context.Context, source iter.Seq2[WarmupKey, error], opts WarmOptions) *WarmReport {
+	start := time.Now()
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultWarmBatchSize
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	report := &WarmReport{}
+	var mu sync.Mutex
+	fail := func(key string, err error) {
+		mu.Lock()
+		report.Failed = append(report.Failed, WarmFailure{Key: key, Err: err})
+		mu.Unlock()
+	}
+	skip := func(n int) {
+		mu.Lock()
+		report.NotAttempted += n
+		mu.Unlock()
+	}
+
+	batches := make(chan []WarmupKey)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				if ctx.Err() != nil {
+					skip(len(batch))
+					continue
+				}
+				for _, failure := range c.warmBatch(ctx, batch) {
+					fail(failure.Key, failure.Err)
+				}
+			}
+		}()
+	}
+
+	batch := make([]WarmupKey, 0, batchSize)
+	stopped := false
+read:
+	for key, err := range source {
+		report.Total++
+		if err != nil {
+			fail(key.Key, err)
+		} else {
+			batch = append(batch, key)
+		}
+		if ctx.Err() != nil {
+			stopped = true
+			break
+		}
+
+		if len(batch) == batchSize {
+			select {
+			case batches <- batch:
+			case <-ctx.Done():
+				stopped = true
+				break read
+			}
+			batch = make([]WarmupKey, 0, batchSize)
+		}
+	}
+	if len(batch) > 0 && ctx.Err() == nil {
+		batches <- batch
+	} else {
+		skip(len(batch))
+	}
+	close(batches)
+	wg.Wait()
+
+	if stopped || report.NotAttempted > 0 {
+		report.Interrupted = ctx.Err()
+	}
+	report.Succeeded = report.Total - len(report.Failed) - report.NotAttempted
+	report.Duration = time.Since(start)
+	return report
+}
+
+// warmBatch writes one batch in a single MULTI/EXEC transaction, so a value
+// and its tags are written together as in SetWithTags, and returns the keys
+// that failed.
+func (c *RedisCache) warmBatch(ctx context.Context, batch []WarmupKey) []WarmFailure {
+	start := time.Now()
+	now := time.Now()
+
+	var failures []WarmFailure
+	var owners []int
+	failed := make(map[int]bool)
+	cmds, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range batch {
+			data, err := c.encode(key.Value)
+			if err != nil {
+				failures = append(failures, WarmFailure{Key: key.Key, Err: fmt.Errorf("cache marshal error: %w", err)})
+				failed[i] = true
+				continue
+			}
+
+			fullKey := c.buildKey(key.Key)
+			pipe.Set(ctx, fullKey, data, key.TTL)
+			owners = append(owners, i)
+
+			score := tagScore(now, key.TTL)
+			for _, tag := range key.Tags {
+				addTagScript.Eval(ctx, pipe, []string{c.tagKey(tag)}, fullKey, score, now.UnixMilli())
+				owners = append(owners, i)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		for j, cmd := range cmds {
+			if cmdErr := cmd.Err(); cmdErr != nil && !errors.Is(cmdErr, redis.Nil) && !failed[owners[j]] {
+				failed[owners[j]] = true
+				failures = append(failures, WarmFailure{Key: batch[owners[j]].Key, Err: cmdErr})
+			}
+		}
+	}
+
+	keys := make([]string, len(batch))
+	var written []string
+	for i, key := range batch {
+		keys[i] = key.Key
+		if !failed[i] {
+			written = append(written, c.buildKey(key.Key))
+		}
+	}
+
+	c.recordBatch(opWarm, keys, start, func(i int) opResult {
+		if failed[i] {
+			return resultError
+		}
+		return resultOK
+	})
+	c.publishKeyEvent(ctx, KeyEventSet, written...)
+
+	return failures
+}
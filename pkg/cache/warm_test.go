@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"testing"
+	"time"
+)
+
+func TestWarmFromLoaderReport(t *testing.T) {
+	errSource := errors.New("row decode failed")
+
+	tests := []struct {
+		name        string
+		opts        WarmOptions
+		keys        int
+		badValue    func(i int) bool
+		badSource   func(i int) bool
+		wantFailed  int
+		wantWritten int
+	}{
+		{
+			name:        "all written in one batch",
+			keys:        10,
+			wantWritten: 10,
+		},
+		{
+			name:        "concurrent batches",
+			opts:        WarmOptions{BatchSize: 3, Concurrency: 4},
+			keys:        50,
+			wantWritten: 50,
+		},
+		{
+			name:        "encode and source failures",
+			opts:        WarmOptions{BatchSize: 4, Concurrency: 3},
+			keys:        40,
+			badValue:    func(i int) bool { return i%7 == 0 },
+			badSource:   func(i int) bool { return i%10 == 5 },
+			wantFailed:  9,
+			wantWritten: 31,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			c, server := newTestRedisCache(t, "app")
+
+			source := func(yield func(WarmupKey, error) bool) {
+				for i := range tt.keys {
+					key := WarmupKey{Key: fmt.Sprintf("item:%d", i), Value: i, TTL: time.Minute, Tags: []string{"items"}}
+					var err error
+					switch {
+					case tt.badSource != nil && tt.badSource(i):
+						err = errSource
+					case tt.badValue != nil && tt.badValue(i):
+						key.Value = make(chan int)
+					}
+					if !yield(key, err) {
+						return
+					}
+				}
+			}
+
+			report := c.WarmFromLoader(ctx, source, tt.opts)
+			if report.Total != tt.keys || report.Succeeded != tt.wantWritten || len(report.Failed) != tt.wantFailed || report.NotAttempted != 0 {
+				t.Fatalf("report = %+v, want %d total, %d written, %d failed", report, tt.keys, tt.wantWritten, tt.wantFailed)
+			}
+
+			failed := make(map[string]bool)
+			for _, failure := range report.Failed {
+				failed[failure.Key] = true
+			}
+			for i := range tt.keys {
+				key := fmt.Sprintf("item:%d", i)
+				if server.Exists("app:"+key) == failed[key] {
+					t.Errorf("%s: stored = %v, failed = %v", key, !failed[key], failed[key])
+				}
+			}
+			if members, _ := server.ZMembers(c.tagKey("items")); len(members) != tt.wantWritten {
+				t.Errorf("tag has %d members, want %d", len(members), tt.wantWritten)
+			}
+
+			err := report.Err()
+			if tt.wantFailed == 0 {
+				if err != nil {
+					t.Errorf("Err = %v, want nil", err)
+				}
+				return
+			}
+			var warmErr *WarmError
+			if !errors.As(err, &warmErr) || !errors.Is(err, errSource) {
+				t.Errorf("Err = %v, want a *WarmError wrapping the source error", err)
+			}
+		})
+	}
+}
+
+func TestWarmFromLoaderStopsOnCancel(t *testing.T) {
+	for _, concurrency := range []int{1, 4} {
+		t.Run(fmt.Sprintf("concurrency %d", concurrency), func(t *testing.T) {
+			c, _ := newTestRedisCache(t, "app")
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// An endless source, like a cursor over a large table.
+			pulled := 0
+			var source iter.Seq2[WarmupKey, error] = func(yield func(WarmupKey, error) bool) {
+				for i := 0; ; i++ {
+					pulled++
+					if i == 25 {
+						cancel()
+					}
+					if !yield(WarmupKey{Key: fmt.Sprintf("item:%d", i), Value: i}, nil) {
+						return
+					}
+				}
+			}
+
+			report := c.WarmFromLoader(ctx, source, WarmOptions{BatchSize: 10, Concurrency: concurrency})
+			if pulled != 26 {
+				t.Fatalf("source read %d keys, want it to stop at the 26th, when ctx was cancelled", pulled)
+			}
+			if report.Total != pulled {
+				t.Errorf("Total = %d, want the %d keys read", report.Total, pulled)
+			}
+			if report.NotAttempted == 0 || report.Succeeded+len(report.Failed)+report.NotAttempted != report.Total {
+				t.Errorf("report = %+v, want the keys read split into written, failed and not attempted", report)
+			}
+			if !errors.Is(report.Interrupted, context.Canceled) || !errors.Is(report.Err(), context.Canceled) {
+				t.Errorf("Interrupted = %v, Err = %v; want context.Canceled", report.Interrupted, report.Err())
+			}
+
+			// A batch in flight at cancellation may reach Redis while its
+			// caller sees the cancellation, so it can be stored but failed.
+			written, _ := c.client.Keys(context.Background(), "app:item:*").Result()
+			if len(written) < report.Succeeded || len(written) > report.Succeeded+len(report.Failed) {
+				t.Errorf("%d keys stored, report says %d written and %d failed", len(written), report.Succeeded, len(report.Failed))
+			}
+		})
+	}
+
+	c, _ := newTestRedisCache(t, "app")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	keys := []WarmupKey{{Key: "a", Value: 1}, {Key: "b", Value: 2}}
+	report := c.WarmWithOptions(ctx, keys, WarmOptions{})
+	if report.Total != 1 || report.NotAttempted != 1 || len(report.Failed) != 0 {
+		t.Errorf("report = %+v, want one key read and not attempted", report)
+	}
+	if err := report.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Err = %v, want context.Canceled", err)
+	}
+}
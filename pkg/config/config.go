@@ -8,7 +8,6 @@ import (
 	"strings"
 
 	"github.com/go-playground/validator/v10"
-	"gopkg.in/yaml.v3"
 )
 
 var Validator = validator.New()
@@ -24,8 +23,8 @@ type DatabaseConfig struct {
 	Port            int    `yaml:"port" validate:"required,min=1,max=65535"`
 	Database        string `yaml:"database" validate:"required"`
 	Username        string `yaml:"username" validate:"required"`
-	Password        string `yaml:"password"`
-	DSN             string `yaml:"dsn"`
+	Password        string `yaml:"password" secret:"true"`
+	DSN             string `yaml:"dsn" secret:"true"`
 	SSLMode         string `yaml:"ssl_mode" validate:"oneof=disable require verify-ca verify-full"`
 	MaxOpenConns    int    `yaml:"max_open_conns" validate:"min=1"`
 	MaxIdleConns    int    `yaml:"max_idle_conns" validate:"min=1"`
@@ -34,7 +33,7 @@ type DatabaseConfig struct {
 
 type RedisConfig struct {
 	Addr         string `yaml:"addr" validate:"required"`
-	Password     string `yaml:"password"`
+	Password     string `yaml:"password" secret:"true"`
 	DB           int    `yaml:"db" validate:"min=0"`
 	PoolSize     int    `yaml:"pool_size" validate:"min=1"`
 	MinIdleConns int    `yaml:"min_idle_conns" validate:"min=0"`
@@ -46,7 +45,7 @@ type GRPCConfig struct {
 }
 
 type SecurityConfig struct {
-	JWTSecret              string `yaml:"jwt_secret" validate:"required,min=32"`
+	JWTSecret              string `yaml:"jwt_secret" validate:"required,min=32" secret:"true"`
 	JWTExpiration          string `yaml:"jwt_expiration" validate:"required"`
 	RefreshExpiration      string `yaml:"refresh_expiration" validate:"required"`
 	RateLimitRPS           int    `yaml:"rate_limit_rps" validate:"min=1"`
@@ -67,27 +66,7 @@ type MonitoringConfig struct {
 }
 
 func LoadConfig[T any](configPath string, target *T) error {
-	data, err := os.ReadFile(configPath)
-
-	fmt.Println(data)
-
-	if err != nil {
-		return fmt.Errorf("failed to read config file: %w", err)
-	}
-
-	if err := yaml.Unmarshal(data, target); err != nil {
-		return fmt.Errorf("failed to parse config: %w", err)
-	}
-
-	if err := applyEnvironmentOverrides(target); err != nil {
-		return fmt.Errorf("failed to apply environment overrides: %w", err)
-	}
-
-	if err := Validator.Struct(target); err != nil {
-		return fmt.Errorf("config validation failed: %w", err)
-	}
-
-	return nil
+	return NewLoader(WithPaths(configPath), WithValidator(Validator)).Load(target)
 }
 
 func LoadConfigWithEnvironment[T any](basePath string, environment string, target *T) error {
@@ -101,16 +80,21 @@ func LoadConfigWithEnvironment[T any](basePath string, environment string, targe
 	return LoadConfig(configPath, target)
 }
 
-func applyEnvironmentOverrides(config interface{}) error {
-	v := reflect.ValueOf(config)
-	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
-		return fmt.Errorf("config must be a pointer to struct")
-	}
-
-	return applyEnvOverridesToStruct(v.Elem(), "")
+func applyEnvOverridesToStruct(v reflect.Value, prefix string, lookupEnv func(string) (string, bool)) error {
+	return walkFields(v, prefix, func(field reflect.Value, fieldType reflect.StructField, envName string) error {
+		if envValue, _ := lookupEnv(envName); envValue != "" {
+			if err := setFieldFromString(field, envValue); err != nil {
+				return fmt.Errorf("failed to set field %s from env %s: %w", fieldType.Name, envName, err)
+			}
+		}
+		return nil
+	})
 }
 
-func applyEnvOverridesToStruct(v reflect.Value, prefix string) error {
+// walkFields calls fn for every settable leaf field with a yaml tag, passing
+// the environment variable name derived from the yaml path. Nested structs
+// extend the prefix unless they are inlined.
+func walkFields(v reflect.Value, prefix string, fn func(field reflect.Value, fieldType reflect.StructField, envName string) error) error {
 	t := v.Type()
 
 	for i := 0; i < v.NumField(); i++ {
@@ -137,18 +121,14 @@ func applyEnvOverridesToStruct(v reflect.Value, prefix string) error {
 			} else {
 				structPrefix = buildEnvName(prefix, yamlName)
 			}
-			if err := applyEnvOverridesToStruct(field, structPrefix); err != nil {
+			if err := walkFields(field, structPrefix, fn); err != nil {
 				return err
 			}
 			continue
 		}
 
-		envName := buildEnvName(prefix, yamlName)
-
-		if envValue := os.Getenv(envName); envValue != "" {
-			if err := setFieldFromString(field, envValue); err != nil {
-				return fmt.Errorf("failed to set field %s from env %s: %w", fieldType.Name, envName, err)
-			}
+		if err := fn(field, fieldType, buildEnvName(prefix, yamlName)); err != nil {
+			return err
 		}
 	}
 
@@ -0,0 +1,67 @@
+package configtest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Zorynix/shared/pkg/config"
+)
+
+// UpdateEnv is the environment variable that makes Golden rewrite snapshots
+// instead of comparing against them.
+const UpdateEnv = "UPDATE_GOLDEN"
+
+// Env returns a loader option that reads environment overrides from env
+// instead of the process environment.
+func Env(env map[string]string) config.Option {
+	return config.WithEnvLookup(config.MapEnv(env))
+}
+
+// Load loads data into target with an empty environment unless opts provide
+// one, failing the test on error.
+func Load(t testing.TB, data string, target interface{}, opts ...config.Option) {
+	t.Helper()
+
+	opts = append([]config.Option{Env(nil)}, opts...)
+	if err := config.NewLoader(opts...).LoadBytes([]byte(data), target); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+}
+
+// Golden loads the fixture file into target, dumps the redacted resolved
+// config and compares it with the snapshot at golden. Run the tests with
+// UPDATE_GOLDEN=1 to write the snapshot instead.
+func Golden(t testing.TB, fixture, golden string, target interface{}, opts ...config.Option) {
+	t.Helper()
+
+	opts = append([]config.Option{Env(nil), config.WithPaths(fixture)}, opts...)
+	if err := config.NewLoader(opts...).Load(target); err != nil {
+		t.Fatalf("load config %s: %v", fixture, err)
+	}
+
+	got, err := config.Dump(target)
+	if err != nil {
+		t.Fatalf("dump config: %v", err)
+	}
+
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+			t.Fatalf("create golden dir: %v", err)
+		}
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatalf("write golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("read golden file (run with %s=1 to create it): %v", UpdateEnv, err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("config %s does not match %s\n--- got\n%s\n--- want\n%s", fixture, golden, got, want)
+	}
+}
@@ -0,0 +1,143 @@
+package configtest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Zorynix/shared/pkg/config"
+)
+
+type serviceConfig struct {
+	Name     string `yaml:"name" validate:"required"`
+	Port     int    `yaml:"port" default:"8080"`
+	Database struct {
+		Host     string `yaml:"host"`
+		Password string `yaml:"password" secret:"true"`
+	} `yaml:"database"`
+}
+
+// recorder is a testing.TB that records failures instead of failing the
+// test, so the helpers' own failures can be checked.
+type recorder struct {
+	testing.TB
+	failed bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(string, ...interface{}) {
+	r.failed = true
+}
+
+func (r *recorder) Fatalf(string, ...interface{}) {
+	r.failed = true
+	runtime.Goexit()
+}
+
+// run calls fn with a recorder on its own goroutine, as Fatalf needs, and
+// reports whether fn failed.
+func run(t *testing.T, fn func(tb testing.TB)) bool {
+	r := &recorder{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(r)
+	}()
+	<-done
+	return r.failed
+}
+
+func TestGolden(t *testing.T) {
+	var cfg serviceConfig
+	Golden(t, "testdata/service.yaml", "testdata/service.golden.yaml", &cfg)
+
+	if cfg.Database.Password != "hunter2" {
+		t.Errorf("password = %q, want the loaded value left in the config", cfg.Database.Password)
+	}
+	golden, err := os.ReadFile("testdata/service.golden.yaml")
+	if err != nil {
+		t.Fatalf("read golden: %v", err)
+	}
+	if !bytes.Contains(golden, []byte(config.RedactedValue)) || bytes.Contains(golden, []byte("hunter2")) {
+		t.Errorf("golden snapshot does not redact the password:\n%s", golden)
+	}
+}
+
+func TestGoldenUpdate(t *testing.T) {
+	dir := t.TempDir()
+	fixture := filepath.Join(dir, "service.yaml")
+	golden := filepath.Join(dir, "snapshots", "service.golden.yaml")
+	writeFixture := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(fixture, []byte(data), 0o644); err != nil {
+			t.Fatalf("write fixture: %v", err)
+		}
+	}
+
+	writeFixture("name: orders\ndatabase:\n  password: hunter2\n")
+	if !run(t, func(tb testing.TB) { Golden(tb, fixture, golden, &serviceConfig{}) }) {
+		t.Fatal("Golden passed without a snapshot")
+	}
+
+	t.Setenv(UpdateEnv, "1")
+	Golden(t, fixture, golden, &serviceConfig{})
+	written, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("snapshot not written: %v", err)
+	}
+	if !strings.Contains(string(written), config.RedactedValue) || strings.Contains(string(written), "hunter2") {
+		t.Errorf("snapshot does not redact the password:\n%s", written)
+	}
+
+	t.Setenv(UpdateEnv, "")
+	Golden(t, fixture, golden, &serviceConfig{})
+
+	writeFixture("name: payments\ndatabase:\n  password: hunter2\n")
+	if !run(t, func(tb testing.TB) { Golden(tb, fixture, golden, &serviceConfig{}) }) {
+		t.Error("Golden passed for a changed config")
+	}
+	// Secrets are redacted before comparing, so changing one alone does
+	// not break the snapshot.
+	writeFixture("name: orders\ndatabase:\n  password: changed\n")
+	Golden(t, fixture, golden, &serviceConfig{})
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("APP_NAME", "from-process")
+
+	var cfg serviceConfig
+	Load(t, "name: orders\n", &cfg, config.WithEnvPrefix("APP"))
+	if cfg.Name != "orders" || cfg.Port != 8080 {
+		t.Errorf("config = %+v, want the data and defaults without the process environment", cfg)
+	}
+
+	cfg = serviceConfig{}
+	Load(t, "name: orders\n", &cfg, config.WithEnvPrefix("APP"), Env(map[string]string{"APP_NAME": "from-env", "APP_PORT": "9090"}))
+	if cfg.Name != "from-env" || cfg.Port != 9090 {
+		t.Errorf("config = %+v, want overrides from Env", cfg)
+	}
+
+	if !run(t, func(tb testing.TB) { Load(tb, "port: 1\n", &serviceConfig{}) }) {
+		t.Error("Load passed for a config failing validation")
+	}
+}
+
+func TestLoadFromBytes(t *testing.T) {
+	var cfg serviceConfig
+	err := config.LoadFromBytes([]byte(`{"name": "orders", "database": {"host": "db"}}`), &cfg, config.WithFormat(config.FormatJSON), Env(nil))
+	if err != nil {
+		t.Fatalf("LoadFromBytes: %v", err)
+	}
+	if cfg.Name != "orders" || cfg.Database.Host != "db" || cfg.Port != 8080 {
+		t.Errorf("config = %+v", cfg)
+	}
+
+	err = config.LoadFromBytes([]byte("name: orders\nunknown: 1\n"), &cfg, config.WithStrict(true), Env(nil))
+	if err == nil {
+		t.Error("LoadFromBytes accepted an unknown key in strict mode")
+	}
+}
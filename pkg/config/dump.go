@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+const RedactedValue = "[REDACTED]"
+
+// Redact returns a copy of config with every field tagged `secret:"true"`
+// replaced by RedactedValue, or zeroed if it is not a string. config may be a
+// struct or a pointer to one; the original is never modified.
+func Redact(config interface{}) (interface{}, error) {
+	v := reflect.ValueOf(config)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config must be a struct or pointer to struct")
+	}
+
+	redacted := reflect.New(v.Type()).Elem()
+	redacted.Set(v)
+
+	err := walkFields(redacted, "", func(field reflect.Value, fieldType reflect.StructField, envName string) error {
+		if !isSecretField(fieldType) || field.IsZero() {
+			return nil
+		}
+		if field.Kind() == reflect.String {
+			field.SetString(RedactedValue)
+		} else {
+			field.Set(reflect.Zero(field.Type()))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return redacted.Interface(), nil
+}
+
+// Dump renders the redacted config as YAML, for logging the resolved config
+// at startup or comparing it against a snapshot.
+func Dump(config interface{}) ([]byte, error) {
+	redacted, err := Redact(config)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := yaml.Marshal(redacted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+)
+
+type EnvVar struct {
+	Name       string
+	Type       string
+	Default    string
+	Validation string
+	Secret     bool
+}
+
+// DescribeEnv lists every environment variable accepted for config, named
+// with the same rules used when applying overrides. Defaults come from the
+// `default` tag, falling back to non-zero values already set in config, so
+// passing a pre-populated struct documents its defaults too.
+func DescribeEnv(config interface{}, prefix string) ([]EnvVar, error) {
+	v := reflect.ValueOf(config)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config must be a struct or pointer to struct")
+	}
+
+	// walkFields only visits settable fields, so walk an addressable copy.
+	copied := reflect.New(v.Type()).Elem()
+	copied.Set(v)
+
+	prefix = strings.ToUpper(strings.TrimSuffix(prefix, "_"))
+
+	var vars []EnvVar
+	err := walkFields(copied, prefix, func(field reflect.Value, fieldType reflect.StructField, envName string) error {
+		envVar := EnvVar{
+			Name:       envName,
+			Type:       field.Type().String(),
+			Validation: fieldType.Tag.Get("validate"),
+			Secret:     isSecretField(fieldType),
+		}
+
+		if def, ok := fieldType.Tag.Lookup("default"); ok {
+			envVar.Default = def
+		} else if !field.IsZero() && !envVar.Secret {
+			envVar.Default = formatDefault(field)
+		}
+
+		vars = append(vars, envVar)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return vars, nil
+}
+
+func formatDefault(field reflect.Value) string {
+	if field.Kind() == reflect.Slice {
+		parts := make([]string, field.Len())
+		for i := range parts {
+			parts[i] = fmt.Sprint(field.Index(i).Interface())
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(field.Interface())
+}
+
+// WriteEnvMarkdown renders vars as a Markdown table for service READMEs.
+func WriteEnvMarkdown(w io.Writer, vars []EnvVar) error {
+	if _, err := fmt.Fprintln(w, "| Variable | Type | Default | Validation | Secret |"); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w, "|---|---|---|---|---|"); err != nil {
+		return err
+	}
+
+	for _, envVar := range vars {
+		secret := ""
+		if envVar.Secret {
+			secret = "yes"
+		}
+		_, err := fmt.Fprintf(w, "| `%s` | `%s` | %s | %s | %s |\n",
+			envVar.Name,
+			envVar.Type,
+			markdownCode(envVar.Default),
+			markdownCode(envVar.Validation),
+			secret,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteEnvTable renders vars as an aligned plain-text table.
+func WriteEnvTable(w io.Writer, vars []EnvVar) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "VARIABLE\tTYPE\tDEFAULT\tVALIDATION\tSECRET")
+	for _, envVar := range vars {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%t\n", envVar.Name, envVar.Type, envVar.Default, envVar.Validation, envVar.Secret)
+	}
+
+	return tw.Flush()
+}
+
+func markdownCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "`" + strings.ReplaceAll(s, "|", "\\|") + "`"
+}
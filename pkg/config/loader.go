@@ -0,0 +1,315 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v3"
+)
+
+type Format string
+
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+)
+
+// SecretProvider resolves values for fields tagged `secret:"true"`. The name
+// passed to LookupSecret is the field's environment variable name.
+type SecretProvider interface {
+	LookupSecret(name string) (string, bool, error)
+}
+
+type SecretProviderFunc func(name string) (string, bool, error)
+
+func (f SecretProviderFunc) LookupSecret(name string) (string, bool, error) {
+	return f(name)
+}
+
+// FileSecretProvider reads secrets from files named after the lowercased
+// environment variable name, as mounted by Docker and Kubernetes secrets.
+type FileSecretProvider struct {
+	Dir string
+}
+
+func NewFileSecretProvider(dir string) *FileSecretProvider {
+	return &FileSecretProvider{Dir: dir}
+}
+
+func (p *FileSecretProvider) LookupSecret(name string) (string, bool, error) {
+	data, err := os.ReadFile(filepath.Join(p.Dir, strings.ToLower(name)))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return strings.TrimSpace(string(data)), true, nil
+}
+
+type configSource struct {
+	path     string
+	optional bool
+}
+
+type Loader struct {
+	sources         []configSource
+	format          Format
+	envPrefix       string
+	secretProviders []SecretProvider
+	strict          bool
+	defaults        map[string]string
+	validate        *validator.Validate
+	lookupEnv       func(string) (string, bool)
+}
+
+type Option func(*Loader)
+
+// WithPaths adds config files that must exist. Files are applied in order,
+// so values from later files override earlier ones.
+func WithPaths(paths ...string) Option {
+	return func(l *Loader) {
+		for _, path := range paths {
+			l.sources = append(l.sources, configSource{path: path})
+		}
+	}
+}
+
+// WithOptionalPaths adds config files that are skipped when missing.
+func WithOptionalPaths(paths ...string) Option {
+	return func(l *Loader) {
+		for _, path := range paths {
+			l.sources = append(l.sources, configSource{path: path, optional: true})
+		}
+	}
+}
+
+// WithFormat forces the decoder for every file instead of detecting it from
+// the file extension.
+func WithFormat(format Format) Option {
+	return func(l *Loader) {
+		l.format = format
+	}
+}
+
+func WithEnvPrefix(prefix string) Option {
+	return func(l *Loader) {
+		l.envPrefix = strings.ToUpper(strings.TrimSuffix(prefix, "_"))
+	}
+}
+
+func WithSecretProvider(provider SecretProvider) Option {
+	return func(l *Loader) {
+		l.secretProviders = append(l.secretProviders, provider)
+	}
+}
+
+// WithStrict rejects config files containing keys that do not map to a field.
+func WithStrict(strict bool) Option {
+	return func(l *Loader) {
+		l.strict = strict
+	}
+}
+
+// WithDefaults sets fallback values keyed by environment variable name
+// without the env prefix, e.g. "DATABASE_PORT". They take precedence over
+// `default` struct tags and are overridden by files and the environment.
+func WithDefaults(defaults map[string]string) Option {
+	return func(l *Loader) {
+		if l.defaults == nil {
+			l.defaults = make(map[string]string, len(defaults))
+		}
+		for name, value := range defaults {
+			l.defaults[strings.ToUpper(name)] = value
+		}
+	}
+}
+
+func WithValidator(v *validator.Validate) Option {
+	return func(l *Loader) {
+		l.validate = v
+	}
+}
+
+// WithEnvLookup replaces os.LookupEnv as the source of environment
+// overrides, e.g. with MapEnv in tests.
+func WithEnvLookup(lookup func(string) (string, bool)) Option {
+	return func(l *Loader) {
+		l.lookupEnv = lookup
+	}
+}
+
+// MapEnv returns an environment lookup backed by env.
+func MapEnv(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func NewLoader(opts ...Option) *Loader {
+	l := &Loader{lookupEnv: os.LookupEnv}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.validate == nil {
+		l.validate = validator.New()
+	}
+	return l
+}
+
+// Load resolves target in order: defaults, config files, environment
+// overrides, secret providers, then validation. target must be a pointer to
+// a struct.
+func (l *Loader) Load(target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config must be a pointer to struct")
+	}
+
+	if err := l.applyDefaults(v.Elem()); err != nil {
+		return fmt.Errorf("failed to apply defaults: %w", err)
+	}
+
+	loaded := 0
+	for _, source := range l.sources {
+		data, err := os.ReadFile(source.path)
+		if err != nil {
+			if source.optional && errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+
+		if err := l.decode(data, l.formatFor(source.path), target); err != nil {
+			return fmt.Errorf("failed to parse config %s: %w", source.path, err)
+		}
+		loaded++
+	}
+
+	if loaded == 0 && len(l.sources) > 0 {
+		return fmt.Errorf("failed to read config file: none of the configured paths exist")
+	}
+
+	return l.resolve(v.Elem(), target)
+}
+
+// LoadBytes is like Load but decodes data instead of the configured paths.
+// The format defaults to YAML unless set with WithFormat.
+func (l *Loader) LoadBytes(data []byte, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config must be a pointer to struct")
+	}
+
+	if err := l.applyDefaults(v.Elem()); err != nil {
+		return fmt.Errorf("failed to apply defaults: %w", err)
+	}
+
+	format := l.format
+	if format == "" {
+		format = FormatYAML
+	}
+	if err := l.decode(data, format, target); err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	return l.resolve(v.Elem(), target)
+}
+
+func LoadFromBytes[T any](data []byte, target *T, opts ...Option) error {
+	return NewLoader(opts...).LoadBytes(data, target)
+}
+
+func (l *Loader) resolve(v reflect.Value, target interface{}) error {
+	if err := applyEnvOverridesToStruct(v, l.envPrefix, l.lookupEnv); err != nil {
+		return fmt.Errorf("failed to apply environment overrides: %w", err)
+	}
+
+	if err := l.applySecrets(v); err != nil {
+		return fmt.Errorf("failed to resolve secrets: %w", err)
+	}
+
+	if err := l.validate.Struct(target); err != nil {
+		return fmt.Errorf("config validation failed: %w", err)
+	}
+
+	return nil
+}
+
+func (l *Loader) formatFor(path string) Format {
+	if l.format != "" {
+		return l.format
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	default:
+		return FormatYAML
+	}
+}
+
+// decode handles JSON with the YAML decoder too: JSON is valid YAML and this
+// keeps `yaml` struct tags authoritative for every format.
+func (l *Loader) decode(data []byte, format Format, target interface{}) error {
+	switch format {
+	case FormatYAML, FormatJSON:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(l.strict)
+		if err := decoder.Decode(target); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported config format: %s", format)
+	}
+}
+
+func (l *Loader) applyDefaults(v reflect.Value) error {
+	return walkFields(v, "", func(field reflect.Value, fieldType reflect.StructField, envName string) error {
+		value, ok := l.defaults[envName]
+		if !ok {
+			value, ok = fieldType.Tag.Lookup("default")
+		}
+		if !ok || !field.IsZero() {
+			return nil
+		}
+		if err := setFieldFromString(field, value); err != nil {
+			return fmt.Errorf("failed to set default for field %s: %w", fieldType.Name, err)
+		}
+		return nil
+	})
+}
+
+func (l *Loader) applySecrets(v reflect.Value) error {
+	if len(l.secretProviders) == 0 {
+		return nil
+	}
+
+	return walkFields(v, l.envPrefix, func(field reflect.Value, fieldType reflect.StructField, envName string) error {
+		if !isSecretField(fieldType) {
+			return nil
+		}
+		for _, provider := range l.secretProviders {
+			value, ok, err := provider.LookupSecret(envName)
+			if err != nil {
+				return fmt.Errorf("failed to look up secret %s: %w", envName, err)
+			}
+			if ok {
+				return setFieldFromString(field, value)
+			}
+		}
+		return nil
+	})
+}
+
+func isSecretField(field reflect.StructField) bool {
+	return field.Tag.Get("secret") == "true"
+}
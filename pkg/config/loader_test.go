@@ -0,0 +1,178 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type loaderConfig struct {
+	Database struct {
+		Host     string `yaml:"host" default:"localhost"`
+		Port     int    `yaml:"port" default:"5432"`
+		Password string `yaml:"password" secret:"true"`
+	} `yaml:"database"`
+	Name string `yaml:"name" default:"app"`
+}
+
+func writeConfig(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	return path
+}
+
+func TestLoaderPrecedence(t *testing.T) {
+	base := writeConfig(t, "base.yaml", "database:\n  host: file-host\n  password: file-password\nname: base\n")
+	override := writeConfig(t, "override.json", `{"database": {"host": "override-host"}}`)
+
+	secrets := SecretProviderFunc(func(name string) (string, bool, error) {
+		if name == "APP_DATABASE_PASSWORD" {
+			return "secret-password", true, nil
+		}
+		return "", false, nil
+	})
+
+	tests := []struct {
+		name         string
+		opts         []Option
+		wantHost     string
+		wantPort     int
+		wantPassword string
+		wantName     string
+	}{
+		{
+			name:     "default tags",
+			wantHost: "localhost",
+			wantPort: 5432,
+			wantName: "app",
+		},
+		{
+			name:     "WithDefaults over default tags",
+			opts:     []Option{WithDefaults(map[string]string{"DATABASE_PORT": "6432"})},
+			wantHost: "localhost",
+			wantPort: 6432,
+			wantName: "app",
+		},
+		{
+			name:         "file over defaults",
+			opts:         []Option{WithDefaults(map[string]string{"DATABASE_HOST": "default-host"}), WithPaths(base)},
+			wantHost:     "file-host",
+			wantPort:     5432,
+			wantPassword: "file-password",
+			wantName:     "base",
+		},
+		{
+			name:         "later file over earlier",
+			opts:         []Option{WithPaths(base, override)},
+			wantHost:     "override-host",
+			wantPort:     5432,
+			wantPassword: "file-password",
+			wantName:     "base",
+		},
+		{
+			name: "env over files",
+			opts: []Option{
+				WithPaths(base, override),
+				WithEnvPrefix("app_"),
+				WithEnvLookup(MapEnv(map[string]string{"APP_DATABASE_HOST": "env-host", "APP_DATABASE_PASSWORD": "env-password", "NAME": "unprefixed"})),
+			},
+			wantHost:     "env-host",
+			wantPort:     5432,
+			wantPassword: "env-password",
+			wantName:     "base",
+		},
+		{
+			name: "empty env keeps file value",
+			opts: []Option{
+				WithPaths(base),
+				WithEnvPrefix("APP"),
+				WithEnvLookup(MapEnv(map[string]string{"APP_DATABASE_HOST": ""})),
+			},
+			wantHost:     "file-host",
+			wantPort:     5432,
+			wantPassword: "file-password",
+			wantName:     "base",
+		},
+		{
+			name: "secrets over env",
+			opts: []Option{
+				WithPaths(base),
+				WithEnvPrefix("APP"),
+				WithEnvLookup(MapEnv(map[string]string{"APP_DATABASE_PASSWORD": "env-password"})),
+				WithSecretProvider(secrets),
+			},
+			wantHost:     "file-host",
+			wantPort:     5432,
+			wantPassword: "secret-password",
+			wantName:     "base",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]Option{WithEnvLookup(MapEnv(nil))}, tt.opts...)
+			var cfg loaderConfig
+			if err := NewLoader(opts...).Load(&cfg); err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Database.Host != tt.wantHost {
+				t.Errorf("host = %q, want %q", cfg.Database.Host, tt.wantHost)
+			}
+			if cfg.Database.Port != tt.wantPort {
+				t.Errorf("port = %d, want %d", cfg.Database.Port, tt.wantPort)
+			}
+			if cfg.Database.Password != tt.wantPassword {
+				t.Errorf("password = %q, want %q", cfg.Database.Password, tt.wantPassword)
+			}
+			if cfg.Name != tt.wantName {
+				t.Errorf("name = %q, want %q", cfg.Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestLoaderSources(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.yaml")
+	unknown := writeConfig(t, "unknown.yaml", "name: svc\nunknown: true\n")
+	valid := writeConfig(t, "valid.yaml", "name: svc\n")
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		wantErr  string
+		wantName string
+	}{
+		{"unknown key allowed", []Option{WithPaths(unknown)}, "", "svc"},
+		{"unknown key strict", []Option{WithPaths(unknown), WithStrict(true)}, "unknown", ""},
+		{"strict valid file", []Option{WithPaths(valid), WithStrict(true)}, "", "svc"},
+		{"optional missing skipped", []Option{WithPaths(valid), WithOptionalPaths(missing)}, "", "svc"},
+		{"required missing", []Option{WithPaths(valid, missing)}, "failed to read config file", ""},
+		{"only optional missing", []Option{WithOptionalPaths(missing)}, "none of the configured paths exist", ""},
+		{"no sources", nil, "", "app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]Option{WithEnvLookup(MapEnv(nil))}, tt.opts...)
+			var cfg loaderConfig
+			err := NewLoader(opts...).Load(&cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Name != tt.wantName {
+				t.Errorf("name = %q, want %q", cfg.Name, tt.wantName)
+			}
+		})
+	}
+}
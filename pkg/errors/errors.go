@@ -103,9 +103,10 @@ var (
 	ErrTokenHasExpired        = NewAppError(ErrTokenExpired, "Token has expired")
 	ErrInvalidUserCredentials = NewAppError(ErrInvalidCredentials, "Invalid user credentials")
 
-	ErrUserAlreadyExists = NewAppError(ErrDuplicateRecord, "User already exists")
-	ErrUserNotFoundError = NewAppError(ErrUserNotFound, "User not found")
-	ErrTestNotFoundError = NewAppError(ErrTestNotFound, "Test not found")
+	ErrUserAlreadyExists   = NewAppError(ErrDuplicateRecord, "User already exists")
+	ErrUserNotFoundError   = NewAppError(ErrUserNotFound, "User not found")
+	ErrTestNotFoundError   = NewAppError(ErrTestNotFound, "Test not found")
+	ErrRecordNotFoundError = NewAppError(ErrRecordNotFound, "Record not found")
 
 	ErrDatabaseConnectionFailed = NewAppError(ErrDatabaseConnection, "Database connection failed")
 	ErrCacheConnectionFailed    = NewAppError(ErrCacheConnection, "Cache connection failed")
@@ -0,0 +1,238 @@
+package flags
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/Zorynix/shared/pkg/config"
+	"github.com/Zorynix/shared/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+type Type string
+
+const (
+	TypeBoolean    Type = "boolean"
+	TypePercentage Type = "percentage"
+	TypeAllowlist  Type = "allowlist"
+)
+
+// Definition describes a single flag. Enabled acts as a kill switch for every
+// type: a disabled flag is off regardless of rollout or allowlist.
+type Definition struct {
+	Type       Type     `yaml:"type" validate:"omitempty,oneof=boolean percentage allowlist"`
+	Enabled    bool     `yaml:"enabled"`
+	Percentage int      `yaml:"percentage" validate:"min=0,max=100"`
+	Users      []string `yaml:"users"`
+}
+
+type Config struct {
+	Flags map[string]Definition `yaml:"flags" validate:"dive"`
+}
+
+// unknownFlagLabel is the flag label for evaluations of undefined flags, so
+// names from typos or user input cannot grow the metric without bound.
+const unknownFlagLabel = "unknown"
+
+var evaluations = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "feature_flag_evaluations_total",
+	Help: "Total number of feature flag evaluations",
+}, []string{"flag", "result"})
+
+type snapshot struct {
+	definitions map[string]Definition
+	allowlists  map[string]map[string]struct{}
+}
+
+type Flags struct {
+	current atomic.Pointer[snapshot]
+	logger  *logger.Logger
+}
+
+type Option func(*Flags)
+
+// WithLogger sets the logger used to report failed reloads.
+func WithLogger(l *logger.Logger) Option {
+	return func(f *Flags) {
+		f.logger = l
+	}
+}
+
+func New(cfg Config, opts ...Option) *Flags {
+	f := &Flags{logger: logger.Discard()}
+	for _, opt := range opts {
+		opt(f)
+	}
+	f.Update(cfg)
+	return f
+}
+
+// Update atomically replaces all flag definitions. Evaluations running
+// concurrently see either the old or the new set, never a mix. Percentages
+// outside [0, 100], which the config validator rejects but a Config built in
+// code may hold, are clamped.
+func (f *Flags) Update(cfg Config) {
+	s := &snapshot{
+		definitions: make(map[string]Definition, len(cfg.Flags)),
+		allowlists:  make(map[string]map[string]struct{}),
+	}
+	for name, def := range cfg.Flags {
+		if def.Type == "" {
+			def.Type = TypeBoolean
+		}
+		if def.Percentage < 0 || def.Percentage > 100 {
+			f.logger.Warn("Feature flag percentage out of range, clamping",
+				zap.String("flag", name), zap.Int("percentage", def.Percentage))
+			def.Percentage = min(max(def.Percentage, 0), 100)
+		}
+		s.definitions[name] = def
+		if len(def.Users) > 0 {
+			users := make(map[string]struct{}, len(def.Users))
+			for _, user := range def.Users {
+				users[user] = struct{}{}
+			}
+			s.allowlists[name] = users
+		}
+	}
+	f.current.Store(s)
+}
+
+// Enabled reports whether the flag is on for the user stored under
+// logger.UserIDKey in ctx. Unknown flags are off and counted under the
+// "unknown" flag label.
+func (f *Flags) Enabled(ctx context.Context, name string) bool {
+	s := f.current.Load()
+	def, ok := s.definitions[name]
+	enabled := ok && s.evaluate(ctx, name, def)
+
+	label := name
+	if !ok {
+		label = unknownFlagLabel
+	}
+	result := "disabled"
+	if enabled {
+		result = "enabled"
+	}
+	evaluations.WithLabelValues(label, result).Inc()
+
+	return enabled
+}
+
+func (s *snapshot) evaluate(ctx context.Context, name string, def Definition) bool {
+	if !def.Enabled {
+		return false
+	}
+
+	userID, _ := ctx.Value(logger.UserIDKey).(string)
+
+	switch def.Type {
+	case TypeBoolean:
+		return true
+	case TypeAllowlist:
+		_, ok := s.allowlists[name][userID]
+		return ok
+	case TypePercentage:
+		if def.Percentage >= 100 {
+			return true
+		}
+		if userID == "" {
+			return false
+		}
+		return bucket(name, userID) < uint32(def.Percentage)
+	default:
+		return false
+	}
+}
+
+// bucket maps a user to a stable value in [0, 100) per flag, so raising the
+// percentage only ever adds users to the rollout.
+func bucket(name, userID string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	_, _ = h.Write([]byte{':'})
+	_, _ = h.Write([]byte(userID))
+	return h.Sum32() % 100
+}
+
+// Definitions returns a copy of the active flag definitions.
+func (f *Flags) Definitions() map[string]Definition {
+	s := f.current.Load()
+	defs := make(map[string]Definition, len(s.definitions))
+	for name, def := range s.definitions {
+		defs[name] = def
+	}
+	return defs
+}
+
+// WatchFile polls path every interval and reloads the flags when its
+// modification time changes. A reload that fails keeps the previous
+// definitions. It blocks until ctx is cancelled.
+func (f *Flags) WatchFile(ctx context.Context, path string, interval time.Duration, opts ...config.Option) error {
+	var lastMod time.Time
+	if info, err := os.Stat(path); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil {
+				f.logger.Warn("Feature flags file unavailable", zap.String("path", path), logger.Err(err))
+				continue
+			}
+			if !info.ModTime().After(lastMod) {
+				continue
+			}
+			lastMod = info.ModTime()
+
+			if err := f.Reload(path, opts...); err != nil {
+				f.logger.Error("Feature flags reload failed", zap.String("path", path), logger.Err(err))
+				continue
+			}
+			f.logger.Info("Feature flags reloaded", zap.String("path", path))
+		}
+	}
+}
+
+// Reload loads flag definitions from path with the config loader and applies
+// them.
+func (f *Flags) Reload(path string, opts ...config.Option) error {
+	var cfg Config
+	loader := config.NewLoader(append([]config.Option{config.WithPaths(path)}, opts...)...)
+	if err := loader.Load(&cfg); err != nil {
+		return fmt.Errorf("failed to load feature flags: %w", err)
+	}
+	f.Update(cfg)
+	return nil
+}
+
+var defaultFlags atomic.Pointer[Flags]
+
+func init() {
+	defaultFlags.Store(New(Config{}))
+}
+
+// SetDefault replaces the flags used by the package-level Enabled.
+func SetDefault(f *Flags) {
+	defaultFlags.Store(f)
+}
+
+func Default() *Flags {
+	return defaultFlags.Load()
+}
+
+func Enabled(ctx context.Context, name string) bool {
+	return defaultFlags.Load().Enabled(ctx, name)
+}
@@ -0,0 +1,211 @@
+package flags
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/Zorynix/shared/pkg/config"
+	"github.com/Zorynix/shared/pkg/logger"
+)
+
+func userCtx(userID string) context.Context {
+	return logger.CreateContextWithUserID(context.Background(), userID)
+}
+
+func users(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("user-%d", i)
+	}
+	return ids
+}
+
+func TestBucketStable(t *testing.T) {
+	spread := make(map[uint32]bool)
+	for _, user := range users(1000) {
+		b := bucket("checkout", user)
+		if b >= 100 {
+			t.Fatalf("bucket(%s) = %d, want < 100", user, b)
+		}
+		if again := bucket("checkout", user); again != b {
+			t.Fatalf("bucket(%s) = %d then %d", user, b, again)
+		}
+		spread[b] = true
+	}
+	if len(spread) < 90 {
+		t.Errorf("1000 users fell into %d buckets, want close to 100", len(spread))
+	}
+
+	// Buckets depend on the flag, so the same users are not first in every
+	// rollout.
+	same := 0
+	for _, user := range users(1000) {
+		if bucket("checkout", user) == bucket("search", user) {
+			same++
+		}
+	}
+	if same > 100 {
+		t.Errorf("%d of 1000 users share a bucket across flags", same)
+	}
+}
+
+func TestPercentageRollout(t *testing.T) {
+	all := users(2000)
+	var previous map[string]bool
+
+	for _, percentage := range []int{0, 10, 25, 50, 90, 100} {
+		f := New(Config{Flags: map[string]Definition{
+			"rollout": {Type: TypePercentage, Enabled: true, Percentage: percentage},
+		}})
+
+		enabled := make(map[string]bool)
+		for _, user := range all {
+			if f.Enabled(userCtx(user), "rollout") {
+				enabled[user] = true
+			}
+		}
+
+		for user := range previous {
+			if !enabled[user] {
+				t.Fatalf("%d%%: %s dropped out of the rollout", percentage, user)
+			}
+		}
+		if want := len(all) * percentage / 100; len(enabled) < want-len(all)/20 || len(enabled) > want+len(all)/20 {
+			t.Errorf("%d%%: %d of %d users enabled, want about %d", percentage, len(enabled), len(all), want)
+		}
+		previous = enabled
+	}
+
+	f := New(Config{Flags: map[string]Definition{
+		"rollout": {Type: TypePercentage, Enabled: true, Percentage: 50},
+	}})
+	if f.Enabled(context.Background(), "rollout") {
+		t.Error("partial rollout enabled for a request without a user")
+	}
+}
+
+func TestPercentageClamped(t *testing.T) {
+	f := New(Config{Flags: map[string]Definition{
+		"negative": {Type: TypePercentage, Enabled: true, Percentage: -1},
+		"over":     {Type: TypePercentage, Enabled: true, Percentage: 150},
+	}})
+
+	for _, user := range users(200) {
+		if f.Enabled(userCtx(user), "negative") {
+			t.Fatalf("negative percentage enabled for %s", user)
+		}
+		if !f.Enabled(userCtx(user), "over") {
+			t.Fatalf("percentage over 100 disabled for %s", user)
+		}
+	}
+	if defs := f.Definitions(); defs["negative"].Percentage != 0 || defs["over"].Percentage != 100 {
+		t.Errorf("definitions = %+v, want percentages clamped to 0 and 100", defs)
+	}
+}
+
+func TestFlagTypes(t *testing.T) {
+	definitions := map[string]Definition{
+		"boolean":   {Enabled: true},
+		"allowlist": {Type: TypeAllowlist, Enabled: true, Users: []string{"alice", "bob"}},
+		"full":      {Type: TypePercentage, Enabled: true, Percentage: 100},
+	}
+
+	tests := []struct {
+		name string
+		flag string
+		user string
+		kill bool
+		want bool
+	}{
+		{"boolean", "boolean", "", false, true},
+		{"allowlisted user", "allowlist", "alice", false, true},
+		{"other user", "allowlist", "carol", false, false},
+		{"allowlist without user", "allowlist", "", false, false},
+		{"full rollout without user", "full", "", false, true},
+		{"unknown flag", "missing", "alice", false, false},
+		{"killed boolean", "boolean", "", true, false},
+		{"killed allowlist", "allowlist", "alice", true, false},
+		{"killed rollout", "full", "alice", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defs := make(map[string]Definition, len(definitions))
+			for name, def := range definitions {
+				def.Enabled = !tt.kill
+				defs[name] = def
+			}
+			f := New(Config{Flags: defs})
+
+			if got := f.Enabled(userCtx(tt.user), tt.flag); got != tt.want {
+				t.Errorf("Enabled(%s, %q) = %v, want %v", tt.flag, tt.user, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnknownFlagsShareALabel(t *testing.T) {
+	f := New(Config{Flags: map[string]Definition{"known": {Enabled: true}}})
+	ctx := context.Background()
+
+	f.Enabled(ctx, "missing-1")
+	series := testutil.CollectAndCount(evaluations)
+	before := testutil.ToFloat64(evaluations.WithLabelValues(unknownFlagLabel, "disabled"))
+
+	for i := range 10 {
+		f.Enabled(ctx, fmt.Sprintf("missing-%d", i))
+	}
+	if got := testutil.CollectAndCount(evaluations); got != series {
+		t.Errorf("unknown flags added %d series", got-series)
+	}
+	if got := testutil.ToFloat64(evaluations.WithLabelValues(unknownFlagLabel, "disabled")); got != before+10 {
+		t.Errorf("unknown evaluations = %v, want %v", got, before+10)
+	}
+
+	f.Enabled(ctx, "known")
+	if got := testutil.ToFloat64(evaluations.WithLabelValues("known", "enabled")); got < 1 {
+		t.Errorf("known flag not counted under its name")
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.yaml")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatalf("write flags: %v", err)
+		}
+	}
+	env := config.WithEnvLookup(config.MapEnv(nil))
+	ctx := userCtx("alice")
+
+	f := New(Config{})
+	write("flags:\n  beta:\n    enabled: true\n")
+	if err := f.Reload(path, env); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if !f.Enabled(ctx, "beta") {
+		t.Fatal("beta off after reload")
+	}
+
+	write("flags:\n  beta:\n    type: allowlist\n    enabled: true\n    users: [bob]\n")
+	if err := f.Reload(path, env); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if f.Enabled(ctx, "beta") || !f.Enabled(userCtx("bob"), "beta") {
+		t.Fatal("allowlist from the reload not applied")
+	}
+
+	write("flags:\n  beta:\n    type: percentage\n    enabled: true\n    percentage: 200\n")
+	if err := f.Reload(path, env); err == nil {
+		t.Fatal("Reload accepted a percentage over 100")
+	}
+	if f.Enabled(ctx, "beta") || !f.Enabled(userCtx("bob"), "beta") {
+		t.Fatal("failed reload replaced the previous definitions")
+	}
+}